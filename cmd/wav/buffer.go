@@ -0,0 +1,467 @@
+package wav
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// Sample is the set of types that samples are stored as: uint8 for 8-bit PCM,
+// int16 for 16-bit PCM, int32 for 24 and 32-bit PCM, int64 for 64-bit PCM, and
+// float32 and float64 for 32 and 64-bit IEEE float.
+type Sample interface {
+	uint8 | int16 | int32 | int64 | float32 | float64
+}
+
+// Buffer is a planar, typed store of sample data, holding one slice of samples
+// per channel, so `b[channel][frame]` is a single sample. Unlike the `Data`
+// field of `Wav`, samples aren't boxed in interfaces, so a Buffer takes a
+// fraction of the memory and can be processed without type switches.
+type Buffer[T Sample] [][]T
+
+// NewBuffer creates a zeroed buffer with the given number of channels and
+// frames (samples per channel). The channels share one backing array.
+func NewBuffer[T Sample](channels, frames int) Buffer[T] {
+	backing := make([]T, channels * frames)
+	buffer := make(Buffer[T], channels)
+	for c := range buffer {
+		buffer[c] = backing[c * frames : (c + 1) * frames : (c + 1) * frames]
+	}
+
+	return buffer
+}
+
+// BufferFromData converts sample groups, as found in the `Data` field of
+// `Wav`, into a Buffer. Every sample must be of type T.
+func BufferFromData[T Sample](data []SampleGroup, channels int) (Buffer[T], error) {
+	buffer := NewBuffer[T](channels, len(data))
+	for i, sampleGroup := range data {
+		if len(sampleGroup.ChannelData) != channels {
+			return nil, fmt.Errorf("sample group %v has %v channels, expected %v", i, len(sampleGroup.ChannelData), channels)
+		}
+
+		for c, v := range sampleGroup.ChannelData {
+			sample, ok := v.(T)
+			if !ok {
+				return nil, fmt.Errorf("can't cast data point %v to %T", v, sample)
+			}
+			buffer[c][i] = sample
+		}
+	}
+
+	return buffer, nil
+}
+
+// Channels returns the number of channels in the buffer
+func (b Buffer[T]) Channels() int {
+	return len(b)
+}
+
+// Frames returns the number of samples in each channel of the buffer
+func (b Buffer[T]) Frames() int {
+	if len(b) == 0 {
+		return 0
+	}
+
+	return len(b[0])
+}
+
+// ToData converts the buffer back into sample groups, as used by the `Data`
+// field of `Wav`
+func (b Buffer[T]) ToData() []SampleGroup {
+	frames, channels := b.Frames(), b.Channels()
+
+	// Allocate every group's channel data in one go rather than per group
+	backing := make([]any, frames * channels)
+	data := make([]SampleGroup, frames)
+	for i := range data {
+		channelData := backing[i * channels : (i + 1) * channels : (i + 1) * channels]
+		for c := range b {
+			channelData[c] = b[c][i]
+		}
+		data[i].ChannelData = channelData
+	}
+
+	return data
+}
+
+// MixToMono averages every channel of the buffer into a single channel. The
+// average is taken around the zero point of the samples, so unsigned 8-bit
+// samples (centred on 128) are mixed correctly.
+func (b Buffer[T]) MixToMono() Buffer[T] {
+	mono := NewBuffer[T](1, b.Frames())
+	_, offset := sampleScale[T](0)
+	isFloat := isFloatSample[T]()
+	for i := range mono[0] {
+		sum := 0.0
+		for c := range b {
+			sum += float64(b[c][i]) - offset
+		}
+
+		average := sum / float64(b.Channels()) + offset
+		if !isFloat {
+			average = math.Round(average)
+		}
+		mono[0][i] = T(average)
+	}
+
+	return mono
+}
+
+// DuplicateToStereo copies the first channel of the buffer into both channels
+// of a new stereo buffer
+func (b Buffer[T]) DuplicateToStereo() Buffer[T] {
+	stereo := NewBuffer[T](2, b.Frames())
+	copy(stereo[0], b[0])
+	copy(stereo[1], b[0])
+
+	return stereo
+}
+
+// Concat returns a new buffer holding the frames of `b` followed by the frames
+// of `toAdd`. Both buffers must have the same number of channels.
+func (b Buffer[T]) Concat(toAdd Buffer[T]) (Buffer[T], error) {
+	if toAdd.Channels() != b.Channels() {
+		return nil, fmt.Errorf("can't concatenate %v channels with %v channels", toAdd.Channels(), b.Channels())
+	}
+
+	combined := NewBuffer[T](b.Channels(), b.Frames() + toAdd.Frames())
+	for c := range combined {
+		copy(combined[c], b[c])
+		copy(combined[c][b.Frames():], toAdd[c])
+	}
+
+	return combined, nil
+}
+
+// Resample converts the buffer from one sample rate to another, without
+// changing its duration or pitch. Integer samples are clamped to full scale
+// for the given bit depth, so e.g. 24-bit samples held as int32 stay within
+// 24 bits.
+func (b Buffer[T]) Resample(sampleRate, newSampleRate uint32, bitsPerSample int) Buffer[T] {
+	if newSampleRate == 0 {
+		return NewBuffer[T](b.Channels(), 0)
+	}
+
+	step := float64(sampleRate) / float64(newSampleRate)
+	frames := int(math.Ceil(float64(b.Frames()) / step))
+	resampled := NewBuffer[T](b.Channels(), frames)
+	resampled.SetFromFloat64(resampleBuffer(b.Float64(bitsPerSample), step, frames, DefaultQuality), bitsPerSample)
+
+	return resampled
+}
+
+// CastBuffer converts every sample in `b` to type D, without any rescaling
+func CastBuffer[D, T Sample](b Buffer[T]) Buffer[D] {
+	cast := NewBuffer[D](b.Channels(), b.Frames())
+	for c := range b {
+		for i, v := range b[c] {
+			cast[c][i] = D(v)
+		}
+	}
+
+	return cast
+}
+
+// Float64 converts the buffer's samples to floats, scaled so that full scale
+// for the given bit depth maps to [-1, 1]. Float samples are left unscaled.
+func (b Buffer[T]) Float64(bitsPerSample int) Buffer[float64] {
+	scale, offset := sampleScale[T](uint16(bitsPerSample))
+	scaled := NewBuffer[float64](b.Channels(), b.Frames())
+	for c := range b {
+		for i, v := range b[c] {
+			scaled[c][i] = (float64(v) - offset) / scale
+		}
+	}
+
+	return scaled
+}
+
+// SetFromFloat64 overwrites the buffer's samples with the values in `values`
+// (which must be the same size), scaling [-1, 1] to full scale for the given
+// bit depth. Integer samples are rounded, and values beyond full scale are
+// clamped. The number of samples that had to be clamped is returned. Float
+// samples are left unscaled and are never clamped.
+func (b Buffer[T]) SetFromFloat64(values Buffer[float64], bitsPerSample int) int {
+	scale, offset := sampleScale[T](uint16(bitsPerSample))
+	if isFloatSample[T]() {
+		for c := range b {
+			for i, v := range values[c] {
+				b[c][i] = T(v)
+			}
+		}
+		return 0
+	}
+
+	// The largest value is one step below full scale. That isn't representable
+	// as a float64 for 64-bit samples, so take it from the integer type
+	var maxSample T
+	if bitsPerSample == 64 {
+		maxSample = maxSampleValue[T]()
+	} else {
+		maxSample = T(scale - 1 + offset)
+	}
+
+	clipped := 0
+	for c := range b {
+		for i, v := range values[c] {
+			scaled := math.Round(v * scale)
+			if scaled >= scale {
+				if scaled > scale {
+					clipped++
+				}
+				b[c][i] = maxSample
+			} else if scaled < -scale {
+				clipped++
+				b[c][i] = T(-scale + offset)
+			} else {
+				b[c][i] = T(scaled + offset)
+			}
+		}
+	}
+
+	return clipped
+}
+
+// sampleScale returns the magnitude that maps to 1.0 for samples of type T at
+// the given bit depth, and the value of silence (128 for unsigned 8-bit
+// samples, 0 otherwise)
+func sampleScale[T Sample](bitsPerSample uint16) (float64, float64) {
+	switch sampleTypeFor[T]() {
+	case float32Samples, float64Samples:
+		return 1, 0
+	case uint8Samples:
+		return 128, 128
+	}
+
+	return math.Ldexp(1, int(bitsPerSample) - 1), 0
+}
+
+// isFloatSample reports whether T is one of the float sample types
+func isFloatSample[T Sample]() bool {
+	sampleType := sampleTypeFor[T]()
+	return sampleType == float32Samples || sampleType == float64Samples
+}
+
+// maxSampleValue returns the largest value that the integer type T can hold
+func maxSampleValue[T Sample]() T {
+	var zero T
+	switch any(zero).(type) {
+	case uint8:
+		return any(uint8(math.MaxUint8)).(T)
+	case int16:
+		return any(int16(math.MaxInt16)).(T)
+	case int32:
+		return any(int32(math.MaxInt32)).(T)
+	case int64:
+		return any(int64(math.MaxInt64)).(T)
+	}
+
+	return zero
+}
+
+// samples is implemented by Buffer[T] for every sample type. It lets the
+// transforms be written once, and run on whichever type a wav's samples are
+// stored as.
+type samples interface {
+	Channels() int
+	Frames() int
+	ToData() []SampleGroup
+
+	// channelFloat64 returns the samples of one channel as float64s, without
+	// any rescaling
+	channelFloat64(channel int) []float64
+
+	toFloat64(bitsPerSample uint16) Buffer[float64]
+	setFromFloat64(values Buffer[float64], bitsPerSample uint16) int
+}
+
+// samples converts the wav's sample data into a Buffer of the type matching
+// its format
+func (w *Wav) samples() (samples, error) {
+	channels := int(w.Channels)
+	switch sampleTypeOf(w.Format()) {
+	case uint8Samples:
+		return BufferFromData[uint8](w.Data, channels)
+	case int16Samples:
+		return BufferFromData[int16](w.Data, channels)
+	case int32Samples:
+		return BufferFromData[int32](w.Data, channels)
+	case int64Samples:
+		return BufferFromData[int64](w.Data, channels)
+	case float32Samples:
+		return BufferFromData[float32](w.Data, channels)
+	case float64Samples:
+		return BufferFromData[float64](w.Data, channels)
+	}
+
+	return nil, fmt.Errorf("unsupported format (format type %v, %v bits/sample)", w.Format().sampleFormat(), w.BitsPerSample)
+}
+
+// newSamples creates a zeroed Buffer of the type matching the given format
+func newSamples(format Format, channels, frames int) (samples, error) {
+	switch sampleTypeOf(format) {
+	case uint8Samples:
+		return NewBuffer[uint8](channels, frames), nil
+	case int16Samples:
+		return NewBuffer[int16](channels, frames), nil
+	case int32Samples:
+		return NewBuffer[int32](channels, frames), nil
+	case int64Samples:
+		return NewBuffer[int64](channels, frames), nil
+	case float32Samples:
+		return NewBuffer[float32](channels, frames), nil
+	case float64Samples:
+		return NewBuffer[float64](channels, frames), nil
+	}
+
+	return nil, fmt.Errorf("unsupported format (format type %v, %v bits/sample)", format.sampleFormat(), format.BitsPerSample)
+}
+
+// Float64Samples returns the wav's samples as floats, one slice per channel,
+// scaled so that full scale maps to [-1, 1] whatever the format. Unsigned
+// 8-bit samples are shifted so that silence is 0, and float samples are
+// returned as they are.
+func (w *Wav) Float64Samples() (Buffer[float64], error) {
+	buffer, err := w.samples()
+	if err != nil {
+		return nil, err
+	}
+
+	return buffer.toFloat64(w.BitsPerSample), nil
+}
+
+// SetFromFloat64 replaces the wav's samples with `values`, one slice per
+// channel, converting them from [-1, 1] to the wav's format. Integer samples
+// are rounded, and values beyond full scale are clamped. Channels, DataSize
+// and the fields derived from them are updated to match `values`.
+func (w *Wav) SetFromFloat64(values Buffer[float64]) error {
+	_, err := w.setFromFloat64(values)
+	return err
+}
+
+// setFromFloat64 is SetFromFloat64, additionally returning the number of
+// samples that had to be clamped
+func (w *Wav) setFromFloat64(values Buffer[float64]) (int, error) {
+	if values.Channels() == 0 {
+		return 0, errors.New("samples must have at least 1 channel")
+	}
+	for c := range values {
+		if len(values[c]) != values.Frames() {
+			return 0, fmt.Errorf("channel %v has %v samples, expected %v", c, len(values[c]), values.Frames())
+		}
+	}
+
+	buffer, err := newSamples(w.Format(), values.Channels(), values.Frames())
+	if err != nil {
+		return 0, err
+	}
+	clipped := buffer.setFromFloat64(values, w.BitsPerSample)
+
+	if int(w.Channels) != values.Channels() {
+		w.Channels = uint16(values.Channels())
+		w.ChannelMask = 0
+	}
+	w.Data = buffer.ToData()
+	w.updateSizes()
+
+	return clipped, nil
+}
+
+// setSampleFormat switches the wav to a new sample format and bit depth,
+// updating the fields derived from them. The sample data itself is left
+// untouched.
+func (w *Wav) setSampleFormat(formatType, bitsPerSample uint16) {
+	if w.FormatType == ExtensibleFormat {
+		w.SubFormat = subFormatGUID(formatType)
+	} else {
+		w.FormatType = formatType
+	}
+	if w.BitsPerSample != bitsPerSample {
+		w.BitsPerSample = bitsPerSample
+		w.ValidBitsPerSample = 0
+	}
+	w.updateSizes()
+}
+
+// updateSizes recalculates DataBlockSize, DataRate and DataSize from the
+// channels, bit depth, sample rate and number of sample groups
+func (w *Wav) updateSizes() {
+	w.DataBlockSize = w.Channels * (w.BitsPerSample / 8)
+	w.DataRate = w.SampleRate * uint32(w.DataBlockSize)
+	w.DataSize = uint32(len(w.Data)) * uint32(w.DataBlockSize)
+}
+
+// sampleType identifies which of the Sample types a format's samples use
+type sampleType int
+
+const (
+	unknownSamples sampleType = iota
+	uint8Samples
+	int16Samples
+	int32Samples
+	int64Samples
+	float32Samples
+	float64Samples
+)
+
+func sampleTypeOf(format Format) sampleType {
+	if format.isFloat() {
+		switch format.BitsPerSample {
+		case 32:
+			return float32Samples
+		case 64:
+			return float64Samples
+		}
+		return unknownSamples
+	}
+
+	switch format.BitsPerSample {
+	case 8:
+		return uint8Samples
+	case 16:
+		return int16Samples
+	case 24, 32:
+		return int32Samples
+	case 64:
+		return int64Samples
+	}
+	return unknownSamples
+}
+
+// sampleTypeFor returns the sampleType matching the Go type T
+func sampleTypeFor[T Sample]() sampleType {
+	var zero T
+	switch any(zero).(type) {
+	case uint8:
+		return uint8Samples
+	case int16:
+		return int16Samples
+	case int32:
+		return int32Samples
+	case int64:
+		return int64Samples
+	case float32:
+		return float32Samples
+	case float64:
+		return float64Samples
+	}
+	return unknownSamples
+}
+
+func (b Buffer[T]) channelFloat64(channel int) []float64 {
+	values := make([]float64, b.Frames())
+	for i, v := range b[channel] {
+		values[i] = float64(v)
+	}
+
+	return values
+}
+
+func (b Buffer[T]) toFloat64(bitsPerSample uint16) Buffer[float64] {
+	return b.Float64(int(bitsPerSample))
+}
+
+func (b Buffer[T]) setFromFloat64(values Buffer[float64], bitsPerSample uint16) int {
+	return b.SetFromFloat64(values, int(bitsPerSample))
+}
@@ -0,0 +1,25 @@
+package wav
+
+import "testing"
+
+// TestBufferResampleClampsToBitDepth checks that 24-bit samples, which are
+// held as int32, are clamped to 24 bits when resampling overshoots full scale
+func TestBufferResampleClampsToBitDepth(t *testing.T) {
+	const maxSample = 1 << 23 - 1
+
+	// A full scale square wave rings past full scale once it's band limited
+	buffer := NewBuffer[int32](1, 4410)
+	for i := range buffer[0] {
+		buffer[0][i] = maxSample
+		if i / 50 % 2 == 1 {
+			buffer[0][i] = -maxSample - 1
+		}
+	}
+
+	resampled := buffer.Resample(44100, 48000, 24)
+	for i, v := range resampled[0] {
+		if v > maxSample || v < -maxSample - 1 {
+			t.Fatalf("sample %v = %v, beyond 24 bits", i, v)
+		}
+	}
+}
@@ -13,72 +13,34 @@ func (w *Wav) ConvertToMono() error {
 		return fmt.Errorf("input must have 2 audio channels, but this one has %v", w.Channels)
 	}
 
+	var err error
+	switch sampleTypeOf(w.Format()) {
+	case uint8Samples:
+		err = mixDataToMono[uint8](w.Data)
+	case int16Samples:
+		err = mixDataToMono[int16](w.Data)
+	case int32Samples:
+		err = mixDataToMono[int32](w.Data)
+	case int64Samples:
+		err = mixDataToMono[int64](w.Data)
+	case float32Samples:
+		err = mixDataToMono[float32](w.Data)
+	case float64Samples:
+		err = mixDataToMono[float64](w.Data)
+	default:
+		err = fmt.Errorf("unsupported format (format type %v, %v bits/sample)", w.Format().sampleFormat(), w.BitsPerSample)
+	}
+	if err != nil {
+		return err
+	}
+
 	w.Channels = 1
 	w.DataSize /= 2
-	for i := 0; i < len(w.Data); i++ {
-		if len(w.Data[i].ChannelData) != 2 {
-			return errors.New("malformed wav struct")
-		}
-		if w.BitsPerSample == uint16(8) {
-			firstChannelVal, ok := w.Data[i].ChannelData[0].(uint8)
-			if !ok {
-				return errors.New("malformed wav struct")
-			}
-
-			secondChannelVal, ok := w.Data[i].ChannelData[1].(uint8)
-			if !ok {
-				return errors.New("malformed wav struct")
-			}
-
-			w.Data[i].ChannelData[0] = (firstChannelVal / 2) + (secondChannelVal / 2)
-			// Remove lingering second channel data
-			w.Data[i].ChannelData = w.Data[i].ChannelData[:1]
-		}
-		if w.BitsPerSample == uint16(16) {
-			firstChannelVal, ok := w.Data[i].ChannelData[0].(int16)
-			if !ok {
-				return errors.New("malformed wav struct")
-			}
-
-			secondChannelVal, ok := w.Data[i].ChannelData[1].(int16)
-			if !ok {
-				return errors.New("malformed wav struct")
-			}
-
-			w.Data[i].ChannelData[0] = (firstChannelVal / 2) + (secondChannelVal / 2)
-			// Remove lingering second channel data
-			w.Data[i].ChannelData = w.Data[i].ChannelData[:1]
-		}
-		if w.BitsPerSample == uint16(32) {
-			firstChannelVal, ok := w.Data[i].ChannelData[0].(int32)
-			if !ok {
-				return errors.New("malformed wav struct")
-			}
-
-			secondChannelVal, ok := w.Data[i].ChannelData[1].(int32)
-			if !ok {
-				return errors.New("malformed wav struct")
-			}
-
-			w.Data[i].ChannelData[0] = (firstChannelVal / 2) + (secondChannelVal / 2)
-			// Remove lingering second channel data
-			w.Data[i].ChannelData = w.Data[i].ChannelData[:1]
-		}
-		if w.BitsPerSample == uint16(64) {
-			firstChannelVal, ok := w.Data[i].ChannelData[0].(int64)
-			if !ok {
-				return errors.New("malformed wav struct")
-			}
-
-			secondChannelVal, ok := w.Data[i].ChannelData[1].(int64)
-			if !ok {
-				return errors.New("malformed wav struct")
-			}
-
-			w.Data[i].ChannelData[0] = (firstChannelVal / 2) + (secondChannelVal / 2)
-			// Remove lingering second channel data
-			w.Data[i].ChannelData = w.Data[i].ChannelData[:1]
-		}
+	w.DataBlockSize /= 2
+	w.DataRate /= 2
+	if w.ChannelMask != 0 {
+		// SPEAKER_FRONT_CENTER
+		w.ChannelMask = 0x4
 	}
 
 	return nil
@@ -91,124 +53,107 @@ func (w *Wav) ConvertToStereo() error {
 		return fmt.Errorf("input must have 1 audio channel, but this one has %v", w.Channels)
 	}
 
-	w.Channels = 2
 	if w.DataSize > math.MaxUint32 / 2 {
 		return errors.New("file size too large to be converted to stereo")
 	}
+
+	if err := duplicateDataToStereo(w.Data); err != nil {
+		return err
+	}
+
+	w.Channels = 2
 	w.DataSize *= 2
-	for i := 0; i < len(w.Data); i++ {
-		if len(w.Data[i].ChannelData) != 1 {
-			return errors.New("malformed wav struct")
-		}
-		w.Data[i].ChannelData = append(w.Data[i].ChannelData, w.Data[i].ChannelData[0])
+	w.DataBlockSize *= 2
+	w.DataRate *= 2
+	if w.ChannelMask != 0 {
+		// SPEAKER_FRONT_LEFT | SPEAKER_FRONT_RIGHT
+		w.ChannelMask = 0x3
 	}
 
 	return nil
 }
 
-// Resample will update the sample rate of the wave file, without
-// changing the duration or pitch.
-func (w *Wav) Resample(newSampleRate uint32) error {
-	sampleDifferenceRatio := float64(w.SampleRate) / float64(newSampleRate)
-	newData := []SampleGroup{}
-
-	rawChannelData := make([][]int, int(w.Channels))
-
-	for i := 0; i < len(w.Data); i++ {
-		for j := 0; j < int(w.Channels); j++ {
-			intValue, err := CastToInt(w.Data[i].ChannelData[j])
-			if err != nil {
-				return err
-			}
-			rawChannelData[j] = append(rawChannelData[j], intValue)
+// mixDataToMono averages the two channels of every sample group in `data` in
+// place, leaving each group with one channel. Every sample must be of type T.
+// The average is taken around the zero point of the samples, as
+// Buffer.MixToMono does. The data is checked before any of it is changed, so
+// malformed data is left as it was.
+func mixDataToMono[T Sample](data []SampleGroup) error {
+	for _, sampleGroup := range data {
+		if len(sampleGroup.ChannelData) != 2 {
+			return errors.New("malformed wav struct")
+		}
+		_, firstOk := sampleGroup.ChannelData[0].(T)
+		_, secondOk := sampleGroup.ChannelData[1].(T)
+		if !firstOk || !secondOk {
+			return errors.New("malformed wav struct")
 		}
 	}
 
-	for i := 0.0; i < float64(len(w.Data)); i += sampleDifferenceRatio {
-		sampleGroupToAdd := SampleGroup{ChannelData: []any{}}
-
-		for j := 0; j < int(w.Channels); j++ {
-			sampleGroupToAdd.ChannelData = append(
-				sampleGroupToAdd.ChannelData,
-				resamplePoint(
-					i,
-					rawChannelData[j],
-					w.SampleRate,
-					1000,
-					4.0,
-				),
-			)
+	_, offset := sampleScale[T](0)
+	isFloat := isFloatSample[T]()
+	for i := range data {
+		channelData := data[i].ChannelData
+		first, second := channelData[0].(T), channelData[1].(T)
+
+		average := (float64(first) - offset + float64(second) - offset) / 2 + offset
+		if !isFloat {
+			average = math.Round(average)
 		}
+		channelData[0] = T(average)
 
-		newData = append(newData, sampleGroupToAdd)
+		// Remove lingering second channel data
+		data[i].ChannelData = channelData[:1]
 	}
 
-	// covert data back to format that it was previously in (int16, for example)
-	finalDataArray := []SampleGroup{}
-	for i := 0; i < len(newData); i++ {
-		newSampleGroup := SampleGroup{
-			ChannelData: []any{},
-		}
-		for j := 0; j < int(w.Channels); j++ {
-			intVal, ok := newData[i].ChannelData[j].(int)
-			if !ok {
-				return fmt.Errorf("could not convert %v to int", newData[i].ChannelData[j])
-			}
-
-			if w.BitsPerSample == uint16(8) {
-				newSampleGroup.ChannelData = append(newSampleGroup.ChannelData, uint8(intVal))
-			}
-			if w.BitsPerSample == uint16(16) {
-				newSampleGroup.ChannelData = append(newSampleGroup.ChannelData, int16(intVal))
-			}
-			if w.BitsPerSample == uint16(32) {
-				newSampleGroup.ChannelData = append(newSampleGroup.ChannelData, int32(intVal))
-			}
-			if w.BitsPerSample == uint16(64) {
-				newSampleGroup.ChannelData = append(newSampleGroup.ChannelData, int64(intVal))
-			}
+	return nil
+}
+
+// duplicateDataToStereo copies the single channel of every sample group in
+// `data` into a second channel, in place. The samples themselves are shared
+// rather than copied, since they're never changed once boxed. The data is
+// checked before any of it is changed, so malformed data is left as it was.
+func duplicateDataToStereo(data []SampleGroup) error {
+	for _, sampleGroup := range data {
+		if len(sampleGroup.ChannelData) != 1 {
+			return errors.New("malformed wav struct")
 		}
-		finalDataArray = append(finalDataArray, newSampleGroup)
 	}
-	
-	w.Data = finalDataArray
-	w.SampleRate = uint32(newSampleRate)
 
-	bytesPerSample := uint32(w.BitsPerSample) / 8
-	w.DataSize = bytesPerSample * uint32(len(w.Data)) * uint32(w.Channels)
+	// Allocate every group's channel data in one go rather than per group
+	backing := make([]any, 2 * len(data))
+	for i := range data {
+		channelData := backing[2 * i : 2 * i + 2 : 2 * i + 2]
+		channelData[0] = data[i].ChannelData[0]
+		channelData[1] = data[i].ChannelData[0]
+		data[i].ChannelData = channelData
+	}
 
 	return nil
 }
 
-func resamplePoint(
-	x float64,
-	initialSamples []int,
-	initialSampleRate uint32,
-	filterCutoffFrequency float64,
-	windowWidth float64,
-) int {
-	var weight, amplitude, sincVal float64
-
-	gainCorrectionFactor := 2 * filterCutoffFrequency / float64(initialSampleRate)
-	filteredSample := 0.0
-
-	for i := -windowWidth / 2; i < windowWidth/2; i++ {
-		inputSampleIndex := int(x + float64(i))
-
-		// weight ranges from 0 to -1, with lower values coming closer to the middle
-		// of the window
-		weight = 0.5 - 0.5 * math.Cos(2 * math.Pi * (0.5 + (float64(inputSampleIndex) - x) / windowWidth))
-		amplitude = math.Pi * (float64(inputSampleIndex) - x) * gainCorrectionFactor
-		sincVal = 1
-
-		if amplitude != 0 {
-			sincVal = math.Sin(amplitude) / amplitude
-		}
+// ConvertBitDepth converts the wav to integer PCM with the given number of bits
+// per sample (8, 16, 24, 32 or 64), rescaling the samples to match. When the
+// bit depth is being reduced (or the wav is currently IEEE float), the dither
+// set in `opts` is applied to avoid truncation distortion.
+func (w *Wav) ConvertBitDepth(bits int, opts DitherOptions) error {
+	switch bits {
+	case 8, 16, 24, 32, 64:
+	default:
+		return fmt.Errorf("bit depth must be one of 8, 16, 24, 32 or 64 (got %v)", bits)
+	}
 
-		if inputSampleIndex >= 0 && inputSampleIndex < len(initialSamples) {
-			filteredSample += gainCorrectionFactor * weight * sincVal * float64(initialSamples[inputSampleIndex])
-		}
+	samples, err := w.Float64Samples()
+	if err != nil {
+		return err
+	}
+
+	// 64-bit samples are more precise than the float64s being converted, so
+	// there's nothing to dither
+	if (w.isFloat() || bits < int(w.BitsPerSample)) && bits < 64 {
+		applyDither(samples, bits, opts)
 	}
 
-	return int(filteredSample)
-}
\ No newline at end of file
+	w.setSampleFormat(PCMFormat, uint16(bits))
+	return w.SetFromFloat64(samples)
+}
@@ -0,0 +1,81 @@
+package wav
+
+import (
+	"math"
+	"testing"
+)
+
+// benchmarkFrames is the length of the wavs used by the benchmarks, about 45
+// seconds at 44.1 kHz
+const benchmarkFrames = 2000000
+
+// newTestWav creates a 16-bit wav holding a 440 Hz sine wave in every channel
+func newTestWav(tb testing.TB, channels, frames int) *Wav {
+	tb.Helper()
+
+	w := &Wav{FormatType: PCMFormat, Channels: uint16(channels), SampleRate: 44100, BitsPerSample: 16}
+	samples := NewBuffer[float64](channels, frames)
+	for c := range samples {
+		for i := range samples[c] {
+			samples[c][i] = 0.5 * math.Sin(2 * math.Pi * 440 * float64(i) / 44100)
+		}
+	}
+	if err := w.SetFromFloat64(samples); err != nil {
+		tb.Fatalf("creating test wav: %v", err)
+	}
+
+	return w
+}
+
+func BenchmarkConvertToMono(b *testing.B) {
+	original := newTestWav(b, 2, benchmarkFrames)
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for n := 0; n < b.N; n++ {
+		// The conversion happens in place, so start each run from a copy
+		b.StopTimer()
+		w := *original
+		w.Data = copySampleGroups(original.Data)
+		b.StartTimer()
+
+		if err := w.ConvertToMono(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkConvertToStereo(b *testing.B) {
+	original := newTestWav(b, 1, benchmarkFrames)
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for n := 0; n < b.N; n++ {
+		b.StopTimer()
+		w := *original
+		w.Data = copySampleGroups(original.Data)
+		b.StartTimer()
+
+		if err := w.ConvertToStereo(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkConcat(b *testing.B) {
+	original := newTestWav(b, 2, benchmarkFrames / 2)
+	toAdd := newTestWav(b, 2, benchmarkFrames / 2)
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for n := 0; n < b.N; n++ {
+		b.StopTimer()
+		w := *original
+		w.Data = copySampleGroups(original.Data)
+		b.StartTimer()
+
+		if err := w.Concat(toAdd); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
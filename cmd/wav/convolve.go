@@ -0,0 +1,145 @@
+package wav
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/liamcr/wavy/internal/util"
+)
+
+// maxConvolutionPartition is the largest number of frames the impulse response
+// is split into for partitioned convolution. Longer partitions need fewer
+// FFTs, but waste more time on short impulse responses.
+const maxConvolutionPartition = 4096
+
+// Convolve runs the wav file through the impulse response `ir`, e.g. of a room
+// for reverb or of a speaker cabinet, mixing the result (wet) with the original
+// audio (dry). `wetDry` is the proportion of the wet signal, from 0 (only the
+// original) to 1 (only the convolved audio).
+//
+// The wav is lengthened by the impulse response's tail, so that reverb isn't
+// cut off. The impulse response is used at its recorded level, so loud or long
+// impulse responses may need turning down (e.g. with ApplyGain) to avoid
+// clipping. It's resampled to the wav's sample rate if they differ, but isn't
+// itself changed.
+//
+// A mono impulse response is applied to every channel. Otherwise, the impulse
+// response must have the same number of channels as the wav, each applied to
+// its own channel, except that a mono wav convolved with a multichannel impulse
+// response takes on its channels (e.g. a mono source placed in a stereo room).
+func (w *Wav) Convolve(ir *Wav, wetDry float64) error {
+	if ir == nil {
+		return errors.New("impulse response can't be nil")
+	}
+	if !(wetDry >= 0 && wetDry <= 1) {
+		return errors.New("wet/dry mix must be between 0 and 1")
+	}
+	if ir.Channels != 1 && w.Channels != 1 && ir.Channels != w.Channels {
+		return fmt.Errorf("cannot convolve a wav with %v channels with an impulse response with %v channels", w.Channels, ir.Channels)
+	}
+
+	samples, err := w.Float64Samples()
+	if err != nil {
+		return err
+	}
+	impulse, err := ir.Float64Samples()
+	if err != nil {
+		return err
+	}
+	if ir.SampleRate != w.SampleRate {
+		if ir.SampleRate == 0 || w.SampleRate == 0 {
+			return errors.New("sample rate must be greater than 0")
+		}
+		step := float64(ir.SampleRate) / float64(w.SampleRate)
+		impulse = resampleBuffer(impulse, step, int(math.Ceil(float64(impulse.Frames()) / step)), DefaultQuality)
+	}
+	if impulse.Frames() == 0 {
+		return errors.New("impulse response can't be empty")
+	}
+
+	channels := util.MaxInt(samples.Channels(), impulse.Channels())
+	frames := samples.Frames() + impulse.Frames() - 1
+	if uint64(frames) * uint64(channels) * uint64(w.BitsPerSample / 8) > math.MaxUint32 {
+		return errors.New("resulting data size would be too large (> max uint32)")
+	}
+
+	partition := util.MinInt(util.NextPowerOfTwo(impulse.Frames()), maxConvolutionPartition)
+	convolved := NewBuffer[float64](channels, frames)
+	for c := range convolved {
+		// A mono wav or impulse response is shared by every channel
+		input := samples[c % samples.Channels()]
+		wet := convolveChannel(input, partitionSpectra(impulse[c % impulse.Channels()], partition), partition, frames)
+
+		for i := range convolved[c] {
+			convolved[c][i] = wetDry * wet[i] + (1 - wetDry) * sampleAt(input, i)
+		}
+	}
+
+	return w.SetFromFloat64(convolved)
+}
+
+// partitionSpectra splits `ir` into partitions of `partition` frames, and
+// returns the spectrum of each, zero padded to twice its length
+func partitionSpectra(ir []float64, partition int) [][]complex128 {
+	spectra := make([][]complex128, (len(ir) + partition - 1) / partition)
+	for p := range spectra {
+		spectra[p] = make([]complex128, 2 * partition)
+		for n := 0; n < partition; n++ {
+			spectra[p][n] = complex(sampleAt(ir, p * partition + n), 0)
+		}
+		util.FFT(spectra[p])
+	}
+
+	return spectra
+}
+
+// convolveChannel convolves `input` with the impulse response whose partition
+// spectra are `partitions`, returning the first `frames` frames. It uses
+// uniformly partitioned overlap-save: the input is transformed a block at a
+// time, and each output block is the sum of the recent input blocks' spectra,
+// each multiplied by the spectrum of the partition as far into the impulse
+// response as the block is in the past.
+func convolveChannel(input []float64, partitions [][]complex128, partition, frames int) []float64 {
+	size := 2 * partition
+	output := make([]float64, frames)
+
+	// The spectra of the most recent input blocks, as a ring buffer with one
+	// block for each partition
+	history := make([][]complex128, len(partitions))
+	for p := range history {
+		history[p] = make([]complex128, size)
+	}
+	sum := make([]complex128, size)
+
+	for block := 0; block * partition < frames; block++ {
+		// Each block's transform covers the block before it too, so that the
+		// circular convolution of the FFT wraps around into samples that are
+		// thrown away
+		spectrum := history[block % len(history)]
+		for n := range spectrum {
+			spectrum[n] = complex(sampleAt(input, (block - 1) * partition + n), 0)
+		}
+		util.FFT(spectrum)
+
+		for n := range sum {
+			sum[n] = 0
+		}
+		for p, h := range partitions {
+			if p > block {
+				break
+			}
+			past := history[(block - p) % len(history)]
+			for n := range sum {
+				sum[n] += past[n] * h[n]
+			}
+		}
+		util.IFFT(sum)
+
+		for n := 0; n < partition && block * partition + n < frames; n++ {
+			output[block * partition + n] = real(sum[partition + n])
+		}
+	}
+
+	return output
+}
@@ -0,0 +1,81 @@
+package wav
+
+import (
+	"errors"
+	"math"
+
+	"github.com/liamcr/wavy/cmd/wav/filter"
+	"github.com/liamcr/wavy/internal/util"
+)
+
+// dcBlockingCutoff is the cutoff, in Hz, of the high pass used by
+// DCBlockingFilter. It's low enough to leave even deep bass alone.
+const dcBlockingCutoff = 5.0
+
+// DCRemovalMethod is a way of removing DC offset from audio
+type DCRemovalMethod int
+
+const (
+	// MeanSubtraction subtracts each channel's average, removing an offset
+	// that stays the same for the whole file
+	MeanSubtraction DCRemovalMethod = iota
+
+	// DCBlockingFilter runs each channel through a gentle, 6 dB per octave
+	// high pass at 5 Hz, which also removes an offset that drifts over time
+	DCBlockingFilter
+)
+
+// DCOffset returns the DC offset of each channel of the wav file: the average
+// of its samples, where -1 and 1 are full scale. Audio without any bias has an
+// offset of 0. Nil is returned for wavs whose samples can't be read.
+func (w *Wav) DCOffset() []float64 {
+	samples, err := w.Float64Samples()
+	if err != nil {
+		return nil
+	}
+
+	offsets := make([]float64, samples.Channels())
+	for c := range samples {
+		offsets[c] = util.Mean(samples[c])
+	}
+
+	return offsets
+}
+
+// RemoveDCOffset removes any DC offset from the wav file, using the given
+// method
+func (w *Wav) RemoveDCOffset(method DCRemovalMethod) error {
+	if method != MeanSubtraction && method != DCBlockingFilter {
+		return errors.New("unknown DC removal method")
+	}
+
+	samples, err := w.Float64Samples()
+	if err != nil {
+		return err
+	}
+
+	for c := range samples {
+		if method == MeanSubtraction {
+			offset := util.Mean(samples[c])
+			for i := range samples[c] {
+				samples[c][i] -= offset
+			}
+			continue
+		}
+
+		// The filter would start with a thump while it settled onto the
+		// offset, so subtract the offset at the start (averaged over the
+		// filter's time constant) first, and let the filter handle any drift
+		// from there
+		pole := math.Exp(-2 * math.Pi * dcBlockingCutoff / float64(w.SampleRate))
+		settle := int(float64(w.SampleRate) / (2 * math.Pi * dcBlockingCutoff))
+		initial := util.Mean(samples[c][: util.MinInt(util.MaxInt(settle, 1), len(samples[c]))])
+
+		blocker := filter.Biquad{B0: 1, B1: -1, A1: -pole}
+		for i, v := range samples[c] {
+			samples[c][i] = blocker.Process(v - initial)
+		}
+	}
+
+	return w.SetFromFloat64(samples)
+}
@@ -0,0 +1,258 @@
+package wav
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/liamcr/wavy/internal/util"
+)
+
+// Decoder reads the sample data of a wav file incrementally, so that long
+// files can be processed without holding all of their samples in memory.
+type Decoder struct {
+	input io.Reader
+	format Format
+
+	// dataSize is the size in bytes of the data chunk
+	dataSize uint32
+
+	// remaining is the number of bytes of the data chunk yet to be read
+	remaining uint32
+
+	// unknownSize is set when the data chunk size is UnknownDataSize, in
+	// which case the data runs to the end of the input
+	unknownSize bool
+
+	// frameSize is the size in bytes of one sample group
+	frameSize int
+
+	// buffer holds the raw bytes of the frames being decoded, and is reused
+	// between calls to Read
+	buffer []byte
+}
+
+// NewDecoder reads the header of the wav file in `input`, up to the start of
+// its data chunk. The sample data can then be read in blocks of any size with
+// `Read`.
+func NewDecoder(input io.Reader) (*Decoder, error) {
+	decoder := &Decoder{input: input}
+
+	riff, err := util.ReadBytes(input, 4)
+	if err != nil {
+		return nil, err
+	}
+	if string(riff) != "RIFF" {
+		return nil, errors.New("corrupted file, first 4 bytes not 'RIFF'")
+	}
+
+	_, err = util.ReadBytes(input, 4)
+	if err != nil {
+		return nil, err
+	}
+
+	wave, err := util.ReadBytes(input, 4)
+	if err != nil {
+		return nil, err
+	}
+	if string(wave) != "WAVE" {
+		return nil, errors.New("corrupted file, bytes 9-12 do not read 'WAVE'")
+	}
+
+	// Scan through the chunks of the file until the data chunk is reached, we
+	// only care about the fmt chunk along the way
+	readFmt := false
+	for {
+		chunkHeader, err := util.ReadBytes(input, 4)
+		if err != nil {
+			return nil, err
+		}
+
+		chunkSizeBytes, err := util.ReadBytes(input, 4)
+		if err != nil {
+			return nil, err
+		}
+
+		chunkSize := util.BytesToUInt32(chunkSizeBytes)
+
+		if string(chunkHeader) == "fmt " {
+			err = readFmtChunk(input, &decoder.format, chunkSize)
+			if err != nil {
+				return nil, err
+			}
+			readFmt = true
+		} else if string(chunkHeader) == "data" {
+			if !readFmt {
+				return nil, errors.New("corrupted file, data chunk found before fmt chunk")
+			}
+			decoder.dataSize = chunkSize
+			decoder.remaining = chunkSize
+			decoder.unknownSize = chunkSize == UnknownDataSize
+			break
+		} else {
+			// Skip to the next chunk, including the pad byte that follows odd
+			// sized chunks
+			_, err = io.CopyN(io.Discard, input, int64(chunkSize) + int64(chunkSize % 2))
+			if err == io.EOF {
+				return nil, io.ErrUnexpectedEOF
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	decoder.frameSize = int(decoder.format.Channels) * int(decoder.format.BitsPerSample) / 8
+	if decoder.frameSize == 0 {
+		return nil, errors.New("corrupted file, fmt chunk has no channels")
+	}
+
+	return decoder, nil
+}
+
+// Format returns the fields of the fmt chunk of the wav file
+func (d *Decoder) Format() Format {
+	return d.format
+}
+
+// DataSize returns the size in bytes of the audio data, or UnknownDataSize if
+// the file was written without knowing its length
+func (d *Decoder) DataSize() uint32 {
+	return d.dataSize
+}
+
+// Frames returns the total number of sample groups in the audio data, or -1 if
+// the file was written without knowing its length
+func (d *Decoder) Frames() int {
+	if d.unknownSize {
+		return -1
+	}
+
+	return int(d.dataSize) / d.frameSize
+}
+
+// Read decodes up to len(frames) sample groups into `frames`, and returns the
+// number of groups read. The ChannelData slices already in `frames` are reused
+// when they're large enough, so the same buffer can be passed to every call.
+// Once all of the audio data has been read, Read returns 0 and io.EOF.
+func (d *Decoder) Read(frames []SampleGroup) (int, error) {
+	byteData, numFrames, err := d.readFrames(len(frames))
+	if err != nil {
+		return 0, err
+	}
+
+	bytesToSample := util.BytesToSample
+	if d.format.isFloat() {
+		bytesToSample = util.BytesToFloatSample
+	}
+
+	channels := int(d.format.Channels)
+	bytesPerSample := int(d.format.BitsPerSample) / 8
+	for i := 0; i < numFrames; i++ {
+		channelData := frames[i].ChannelData
+		if cap(channelData) < channels {
+			channelData = make([]any, channels)
+		}
+		channelData = channelData[:channels]
+
+		for j := 0; j < channels; j++ {
+			offset := i * d.frameSize + j * bytesPerSample
+			sample, err := bytesToSample(byteData[offset:offset + bytesPerSample], d.format.BitsPerSample)
+			if err != nil {
+				return i, err
+			}
+			channelData[j] = sample
+		}
+
+		frames[i].ChannelData = channelData
+	}
+
+	return numFrames, nil
+}
+
+// ReadBuffer decodes up to buffer.Frames() sample groups straight into
+// `buffer`, without boxing each sample, and returns the number of groups read.
+// T must be the type that Decode would produce for the decoder's format (e.g.
+// int16 for 16-bit PCM), and the buffer must have one slice per channel. Once
+// all of the audio data has been read, ReadBuffer returns 0 and io.EOF.
+func ReadBuffer[T Sample](d *Decoder, buffer Buffer[T]) (int, error) {
+	if sampleTypeFor[T]() != sampleTypeOf(d.format) {
+		var zero T
+		return 0, fmt.Errorf("can't decode %v-bit samples into a buffer of %T", d.format.BitsPerSample, zero)
+	}
+	if buffer.Channels() != int(d.format.Channels) {
+		return 0, fmt.Errorf("buffer has %v channels, expected %v", buffer.Channels(), d.format.Channels)
+	}
+
+	byteData, numFrames, err := d.readFrames(buffer.Frames())
+	if err != nil {
+		return 0, err
+	}
+
+	bytesPerSample := int(d.format.BitsPerSample) / 8
+	isFloat := d.format.isFloat()
+	for c := range buffer {
+		for i := 0; i < numFrames; i++ {
+			sampleBytes := byteData[i * d.frameSize + c * bytesPerSample:]
+			switch {
+			case isFloat && bytesPerSample == 4:
+				buffer[c][i] = T(math.Float32frombits(binary.LittleEndian.Uint32(sampleBytes)))
+			case isFloat:
+				buffer[c][i] = T(math.Float64frombits(binary.LittleEndian.Uint64(sampleBytes)))
+			case bytesPerSample == 1:
+				buffer[c][i] = T(sampleBytes[0])
+			case bytesPerSample == 2:
+				buffer[c][i] = T(int16(binary.LittleEndian.Uint16(sampleBytes)))
+			case bytesPerSample == 3:
+				buffer[c][i] = T(util.BytesToInt24(sampleBytes))
+			case bytesPerSample == 4:
+				buffer[c][i] = T(int32(binary.LittleEndian.Uint32(sampleBytes)))
+			default:
+				buffer[c][i] = T(int64(binary.LittleEndian.Uint64(sampleBytes)))
+			}
+		}
+	}
+
+	return numFrames, nil
+}
+
+// readFrames reads the raw bytes of up to maxFrames sample groups from the data
+// chunk, returning them along with the number of groups they hold
+func (d *Decoder) readFrames(maxFrames int) ([]byte, int, error) {
+	numFrames := maxFrames
+	if available := int(d.remaining) / d.frameSize; !d.unknownSize && available < numFrames {
+		numFrames = available
+	}
+	if numFrames == 0 && maxFrames > 0 {
+		return nil, 0, io.EOF
+	}
+
+	numBytes := numFrames * d.frameSize
+	if cap(d.buffer) < numBytes {
+		d.buffer = make([]byte, numBytes)
+	}
+	byteData := d.buffer[:numBytes]
+	bytesRead, err := io.ReadFull(d.input, byteData)
+	if d.unknownSize && (err == io.EOF || err == io.ErrUnexpectedEOF) {
+		// Reaching the end of the input is how data of unknown size ends.
+		// Any trailing partial sample group is dropped
+		numFrames = bytesRead / d.frameSize
+		if numFrames == 0 {
+			return nil, 0, io.EOF
+		}
+		err = nil
+	}
+	if err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, 0, err
+	}
+	if !d.unknownSize {
+		d.remaining -= uint32(numBytes)
+	}
+
+	return byteData, numFrames, nil
+}
@@ -0,0 +1,76 @@
+package wav
+
+import (
+	"math"
+	"math/rand"
+)
+
+// Dither is a type of low level noise added to samples when reducing their bit
+// depth. It turns the distortion caused by truncating samples into a constant,
+// much less noticeable, noise floor.
+type Dither int
+
+const (
+	// NoDither rounds samples to the nearest value at the new bit depth
+	NoDither Dither = iota
+
+	// RectangularDither adds noise with a uniform distribution of 1 LSB
+	// (least significant bit) peak to peak
+	RectangularDither
+
+	// TPDFDither adds noise with a triangular probability density function of
+	// 2 LSB peak to peak. This fully decorrelates the quantization error from
+	// the signal, and is the usual choice for mastering
+	TPDFDither
+
+	// NoiseShapedDither adds TPDF dither, and feeds the quantization error of
+	// each sample back into the next. This pushes the noise up towards high
+	// frequencies, where it's less audible
+	NoiseShapedDither
+)
+
+// DitherOptions configures how samples are quantized by ConvertBitDepth
+type DitherOptions struct {
+	// Type is the type of dither to apply
+	Type Dither
+
+	// Seed seeds the random noise used for dithering, so that conversions can
+	// be reproduced exactly
+	Seed int64
+}
+
+// applyDither adds dither noise to `samples`, which are normalized to
+// [-1, 1], ahead of them being quantized to `bitsPerSample` bits
+func applyDither(samples Buffer[float64], bitsPerSample int, opts DitherOptions) {
+	if opts.Type == NoDither {
+		return
+	}
+
+	lsb := math.Ldexp(1, 1 - bitsPerSample)
+	random := rand.New(rand.NewSource(opts.Seed))
+
+	for c := range samples {
+		quantizationError := 0.0
+		for i, v := range samples[c] {
+			var noise float64
+			if opts.Type == RectangularDither {
+				noise = (random.Float64() - 0.5) * lsb
+			} else {
+				noise = (random.Float64() - random.Float64()) * lsb
+			}
+
+			if opts.Type != NoiseShapedDither {
+				samples[c][i] = v + noise
+				continue
+			}
+
+			// First order error feedback: subtract the error made quantizing
+			// the previous sample, and quantize here so that this sample's
+			// error is known
+			shaped := v - quantizationError
+			quantized := math.Round((shaped + noise) / lsb) * lsb
+			quantizationError = quantized - shaped
+			samples[c][i] = quantized
+		}
+	}
+}
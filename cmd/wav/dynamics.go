@@ -0,0 +1,412 @@
+package wav
+
+import (
+	"errors"
+	"math"
+	"time"
+
+	"github.com/liamcr/wavy/internal/util"
+)
+
+const (
+	// minLevelDB is the level that silence is treated as having, so that
+	// levels in decibels stay finite
+	minLevelDB = -200.0
+
+	// limiterRelease is how long the limiter takes to recover after a peak,
+	// on top of its lookahead
+	limiterRelease = 50 * time.Millisecond
+
+	// gateAttack is how long the gate takes to open fully, which is kept
+	// short so that the start of sounds isn't lost, but long enough to not
+	// click
+	gateAttack = time.Millisecond
+
+	// gateEnvelopeRelease is how quickly the level the gate follows falls
+	// away, so that the gate doesn't close at every zero crossing
+	gateEnvelopeRelease = 10 * time.Millisecond
+)
+
+// Detection is how the level of multichannel audio is measured by a dynamics
+// processor
+type Detection int
+
+const (
+	// LinkedDetection measures the loudest channel, and applies the same gain
+	// to every channel. This keeps the balance between channels, so the
+	// stereo image doesn't shift.
+	LinkedDetection Detection = iota
+
+	// PerChannelDetection measures and processes every channel on its own
+	PerChannelDetection
+)
+
+// CompressorOptions configures the compressor applied by Compress
+type CompressorOptions struct {
+	// ThresholdDB is the level, in dBFS, above which audio is compressed
+	ThresholdDB float64
+
+	// Ratio is how much the level above the threshold is reduced by, e.g. 4
+	// for 4:1 compression. It must be at least 1.
+	Ratio float64
+
+	// Attack is how quickly the compressor responds to audio going above the
+	// threshold
+	Attack time.Duration
+
+	// Release is how quickly the compressor recovers once audio drops back
+	// below the threshold
+	Release time.Duration
+
+	// KneeDB is the width, in dB, of the range around the threshold over which
+	// compression is eased in. Zero gives a hard knee.
+	KneeDB float64
+
+	// MakeupDB is the gain, in dB, applied after compression to make up for
+	// the drop in level
+	MakeupDB float64
+
+	// Detection is how the level of multichannel audio is measured
+	Detection Detection
+}
+
+// LimiterOptions configures the limiter applied by LimitWithOptions
+type LimiterOptions struct {
+	// CeilingDBFS is the level, in dBFS, that the audio won't go above
+	CeilingDBFS float64
+
+	// Lookahead is how far ahead the limiter looks for peaks, so that it can
+	// start turning down just before them. A few milliseconds is usually
+	// enough.
+	Lookahead time.Duration
+
+	// Detection is how the level of multichannel audio is measured
+	Detection Detection
+}
+
+// GateOptions configures the gate or expander applied by GateWithOptions
+type GateOptions struct {
+	// ThresholdDB is the level, in dBFS, below which audio is turned down
+	ThresholdDB float64
+
+	// Hold is how long the gate waits after the audio drops below the
+	// threshold before closing
+	Hold time.Duration
+
+	// Release is how long the gate takes to close
+	Release time.Duration
+
+	// Ratio makes the gate a downward expander: audio below the threshold is
+	// turned down so that every dB it's below the threshold becomes Ratio dB,
+	// e.g. 2 for 1:2 expansion. Zero silences audio below the threshold, as a
+	// gate does.
+	Ratio float64
+
+	// RangeDB is the most, in dB, that audio is turned down by, e.g. 20 to
+	// leave some background noise rather than silence. Zero places no limit.
+	RangeDB float64
+
+	// Detection is how the level of multichannel audio is measured
+	Detection Detection
+}
+
+// Compress reduces the dynamic range of the wav file, turning down audio that
+// goes above a threshold.
+func (w *Wav) Compress(opts CompressorOptions) error {
+	if opts.Ratio < 1 {
+		return errors.New("ratio must be at least 1")
+	}
+	if opts.KneeDB < 0 || opts.Attack < 0 || opts.Release < 0 {
+		return errors.New("knee, attack and release can't be negative")
+	}
+	if opts.Detection != LinkedDetection && opts.Detection != PerChannelDetection {
+		return errors.New("unknown detection")
+	}
+
+	samples, err := w.Float64Samples()
+	if err != nil {
+		return err
+	}
+
+	attack := smoothingCoefficient(opts.Attack, w.SampleRate)
+	release := smoothingCoefficient(opts.Release, w.SampleRate)
+	makeup := math.Pow(10, opts.MakeupDB / 20)
+
+	for _, group := range detectionGroups(samples, opts.Detection) {
+		// Follow the peaks of the audio, letting the level fall away at the
+		// release rate so that it doesn't drop between the peaks of a
+		// waveform, then ease into the gain reduction at the attack rate
+		envelope := 0.0
+		reduction := 0.0
+		for i := 0; i < samples.Frames(); i++ {
+			peak := groupPeak(group, i)
+			if peak > envelope {
+				envelope = peak
+			} else {
+				envelope = release * envelope + (1 - release) * peak
+			}
+
+			target := compressorGain(levelDB(envelope), opts)
+			if target < reduction {
+				reduction = attack * reduction + (1 - attack) * target
+			} else {
+				reduction = target
+			}
+
+			gain := math.Pow(10, reduction / 20) * makeup
+			for _, channel := range group {
+				channel[i] *= gain
+			}
+		}
+	}
+
+	_, err = w.setFromFloat64(samples)
+	return err
+}
+
+// Limit stops the wav file from going above `ceilingDBFS`, turning down the
+// peaks that would. The limiter looks ahead by `lookahead`, so that it can
+// start turning down just before a peak rather than distorting it; a few
+// milliseconds is usually enough. Every channel is turned down by the same
+// amount; use LimitWithOptions to limit each channel on its own.
+func (w *Wav) Limit(ceilingDBFS float64, lookahead time.Duration) error {
+	return w.LimitWithOptions(LimiterOptions{CeilingDBFS: ceilingDBFS, Lookahead: lookahead})
+}
+
+// LimitWithOptions stops the wav file from going above a ceiling, as Limit
+// does
+func (w *Wav) LimitWithOptions(opts LimiterOptions) error {
+	if math.IsNaN(opts.CeilingDBFS) || math.IsInf(opts.CeilingDBFS, 0) {
+		return errors.New("ceiling must be a finite number of decibels")
+	}
+	if opts.Lookahead < 0 {
+		return errors.New("lookahead can't be negative")
+	}
+	if opts.Detection != LinkedDetection && opts.Detection != PerChannelDetection {
+		return errors.New("unknown detection")
+	}
+
+	samples, err := w.Float64Samples()
+	if err != nil {
+		return err
+	}
+
+	frames := samples.Frames()
+	if frames == 0 {
+		return nil
+	}
+	ceiling := math.Pow(10, opts.CeilingDBFS / 20)
+	lookaheadFrames := w.frameAt(opts.Lookahead)
+	window := float64(lookaheadFrames + 1)
+	release := smoothingCoefficient(limiterRelease, w.SampleRate)
+
+	for _, group := range detectionGroups(samples, opts.Detection) {
+		// The gain each frame needs to stay below the ceiling
+		required := make([]float64, frames)
+		for i := range required {
+			required[i] = 1
+			if peak := groupPeak(group, i); peak > ceiling {
+				required[i] = ceiling / peak
+			}
+		}
+
+		// Hold the lowest gain needed over the lookahead window, then
+		// average that over the window so the gain ramps smoothly. Every
+		// frame averaged includes the current frame in its window, so the
+		// average is never above the gain the current frame needs. Frames
+		// before the start are treated as holding the first frame's gain,
+		// whose window also includes the current frame.
+		held := slidingMin(required, lookaheadFrames)
+		gain := 1.0
+		sum := held[0] * window
+		for i := 0; i < frames; i++ {
+			sum += held[i] - held[util.MaxInt(i - lookaheadFrames - 1, 0)]
+			smoothed := sum / window
+
+			if smoothed < gain {
+				gain = smoothed
+			} else {
+				gain = release * gain + (1 - release) * smoothed
+			}
+
+			for _, channel := range group {
+				channel[i] *= gain
+			}
+		}
+	}
+
+	_, err = w.setFromFloat64(samples)
+	return err
+}
+
+// Gate silences the wav file whenever it drops below `thresholdDB` dBFS, to
+// cut out background noise between sounds. Once the level drops below the
+// threshold, the gate waits for `hold` before closing over `release`. The gate
+// follows the loudest channel, and opens and closes every channel together;
+// use GateWithOptions to gate each channel on its own, or to turn quiet audio
+// down rather than silencing it.
+func (w *Wav) Gate(thresholdDB float64, hold, release time.Duration) error {
+	return w.GateWithOptions(GateOptions{ThresholdDB: thresholdDB, Hold: hold, Release: release})
+}
+
+// GateWithOptions turns the wav file down whenever it drops below a
+// threshold, as a noise gate or downward expander
+func (w *Wav) GateWithOptions(opts GateOptions) error {
+	if math.IsNaN(opts.ThresholdDB) {
+		return errors.New("threshold must be a number of decibels")
+	}
+	if opts.Hold < 0 || opts.Release < 0 {
+		return errors.New("hold and release can't be negative")
+	}
+	if opts.Ratio != 0 && !(opts.Ratio >= 1) {
+		return errors.New("ratio must be at least 1, or 0 for a gate")
+	}
+	if !(opts.RangeDB >= 0) {
+		return errors.New("range can't be negative")
+	}
+	if opts.Detection != LinkedDetection && opts.Detection != PerChannelDetection {
+		return errors.New("unknown detection")
+	}
+
+	samples, err := w.Float64Samples()
+	if err != nil {
+		return err
+	}
+
+	threshold := math.Pow(10, opts.ThresholdDB / 20)
+	holdFrames := w.frameAt(opts.Hold)
+	openStep := 1 / math.Max(float64(w.frameAt(gateAttack)), 1)
+	closeStep := 1 / math.Max(float64(w.frameAt(opts.Release)), 1)
+	envelopeRelease := smoothingCoefficient(gateEnvelopeRelease, w.SampleRate)
+
+	for _, group := range detectionGroups(samples, opts.Detection) {
+		// How open the gate is, from 0 (closed) to 1 (open)
+		open := 0.0
+		envelope := 0.0
+		sinceAbove := holdFrames + 1
+		for i := 0; i < samples.Frames(); i++ {
+			envelope = math.Max(groupPeak(group, i), envelope * envelopeRelease)
+
+			if envelope >= threshold {
+				sinceAbove = 0
+			} else {
+				sinceAbove++
+			}
+
+			if sinceAbove <= holdFrames {
+				open = math.Min(1, open + openStep)
+			} else {
+				open = math.Max(0, open - closeStep)
+			}
+
+			closed := closedGateGain(levelDB(envelope), opts)
+			gain := closed + (1 - closed) * open
+			for _, channel := range group {
+				channel[i] *= gain
+			}
+		}
+	}
+
+	_, err = w.setFromFloat64(samples)
+	return err
+}
+
+// closedGateGain returns the gain the gate applies to audio at `level` dBFS
+// once it has closed: silence for a gate, or for an expander, the level below
+// the threshold multiplied by the ratio. Either way it's limited by the range.
+func closedGateGain(level float64, opts GateOptions) float64 {
+	reduction := math.Inf(-1)
+	if opts.Ratio != 0 {
+		reduction = math.Min(level - opts.ThresholdDB, 0) * (opts.Ratio - 1)
+	}
+	if opts.RangeDB > 0 {
+		reduction = math.Max(reduction, -opts.RangeDB)
+	}
+
+	return math.Pow(10, reduction / 20)
+}
+
+// compressorGain returns the gain, in dB, that the compressor applies to audio
+// at `level` dBFS, before smoothing
+func compressorGain(level float64, opts CompressorOptions) float64 {
+	over := level - opts.ThresholdDB
+	slope := 1 / opts.Ratio - 1
+
+	if 2 * math.Abs(over) <= opts.KneeDB && opts.KneeDB > 0 {
+		// Within the knee, ease from no compression into full compression
+		eased := over + opts.KneeDB / 2
+		return slope * eased * eased / (2 * opts.KneeDB)
+	}
+	if over > 0 {
+		return slope * over
+	}
+
+	return 0
+}
+
+// detectionGroups splits the channels of `samples` into the groups that are
+// measured and processed together: all of them when linked, or each on its
+// own
+func detectionGroups(samples Buffer[float64], detection Detection) [][][]float64 {
+	if detection == LinkedDetection {
+		return [][][]float64{samples}
+	}
+
+	groups := make([][][]float64, samples.Channels())
+	for c := range samples {
+		groups[c] = [][]float64{samples[c]}
+	}
+
+	return groups
+}
+
+// groupPeak returns the largest magnitude of any channel in `group` at frame
+// `i`
+func groupPeak(group [][]float64, i int) float64 {
+	peak := 0.0
+	for _, channel := range group {
+		peak = math.Max(peak, math.Abs(channel[i]))
+	}
+
+	return peak
+}
+
+// levelDB converts a sample magnitude into dBFS
+func levelDB(magnitude float64) float64 {
+	if magnitude == 0 {
+		return minLevelDB
+	}
+
+	return math.Max(20 * math.Log10(magnitude), minLevelDB)
+}
+
+// smoothingCoefficient returns the coefficient of a one pole smoothing filter
+// with the given time constant. A time of 0 gives no smoothing.
+func smoothingCoefficient(d time.Duration, sampleRate uint32) float64 {
+	if d <= 0 {
+		return 0
+	}
+
+	return math.Exp(-1 / (d.Seconds() * float64(sampleRate)))
+}
+
+// slidingMin returns, for each index, the smallest value in `values` from that
+// index to `window` indices after it
+func slidingMin(values []float64, window int) []float64 {
+	mins := make([]float64, len(values))
+
+	// Indices of candidates for the minimum, with increasing values
+	candidates := make([]int, 0, window + 1)
+	for i := len(values) - 1; i >= 0; i-- {
+		for len(candidates) > 0 && values[candidates[len(candidates) - 1]] >= values[i] {
+			candidates = candidates[:len(candidates) - 1]
+		}
+		candidates = append(candidates, i)
+		if candidates[0] > i + window {
+			candidates = candidates[1:]
+		}
+		mins[i] = values[candidates[0]]
+	}
+
+	return mins
+}
@@ -0,0 +1,260 @@
+package wav
+
+import (
+	"errors"
+	"math"
+	"time"
+
+	"github.com/liamcr/wavy/internal/util"
+)
+
+// effectTailRange is how far, in dB, the echoes of an effect with feedback
+// die away by the end of its tail
+const effectTailRange = 60.0
+
+// DelayOptions configures the echo added by DelayWithOptions
+type DelayOptions struct {
+	// Time is the time between the original audio and its first echo, and
+	// between each echo after that
+	Time time.Duration
+
+	// Feedback is how much of each echo is fed back into the delay to make
+	// the next one, from 0 (a single echo) to just under 1 (echoes that take
+	// a very long time to die away)
+	Feedback float64
+
+	// Mix is the proportion of the echoes in the output, from 0 (only the
+	// original audio) to 1 (only the echoes)
+	Mix float64
+
+	// ExtendTail lengthens the wav so that the echoes can die away, rather
+	// than being cut off at the end of the original audio
+	ExtendTail bool
+}
+
+// ChorusOptions configures the chorus applied by Chorus
+type ChorusOptions struct {
+	// Delay is the shortest time the copy of the audio is delayed by
+	Delay time.Duration
+
+	// Depth is how much further the delay sweeps, on top of Delay
+	Depth time.Duration
+
+	// Rate is how many times a second the delay sweeps back and forth
+	Rate float64
+
+	// Mix is the proportion of the delayed copy in the output, from 0 to 1
+	Mix float64
+
+	// ExtendTail lengthens the wav by the longest delay, so that the delayed
+	// copy isn't cut off
+	ExtendTail bool
+}
+
+// FlangerOptions configures the flanger applied by Flanger
+type FlangerOptions struct {
+	// Delay is the shortest time the copy of the audio is delayed by
+	Delay time.Duration
+
+	// Depth is how much further the delay sweeps, on top of Delay
+	Depth time.Duration
+
+	// Rate is how many times a second the delay sweeps back and forth
+	Rate float64
+
+	// Feedback is how much of the delayed copy is fed back into the delay,
+	// which strengthens the effect. It must be between -1 and 1 (exclusive);
+	// negative values invert what is fed back, changing its tone.
+	Feedback float64
+
+	// Mix is the proportion of the delayed copy in the output, from 0 to 1
+	Mix float64
+
+	// ExtendTail lengthens the wav so that the delayed copy can die away,
+	// rather than being cut off
+	ExtendTail bool
+}
+
+// DefaultChorus is a typical, gentle chorus
+var DefaultChorus = ChorusOptions{Delay: 20 * time.Millisecond, Depth: 5 * time.Millisecond, Rate: 0.8, Mix: 0.5}
+
+// DefaultFlanger is a typical, slowly sweeping flanger
+var DefaultFlanger = FlangerOptions{Delay: time.Millisecond, Depth: 3 * time.Millisecond, Rate: 0.25, Feedback: 0.5, Mix: 0.5}
+
+// Delay adds echoes to the wav file, `delay` apart, each `feedback` times the
+// level of the last, mixed in with the original audio by `mix` (see
+// DelayOptions). The wav keeps its length, so echoes past the end are cut off;
+// use DelayWithOptions to keep them.
+func (w *Wav) Delay(delay time.Duration, feedback, mix float64) error {
+	return w.DelayWithOptions(DelayOptions{Time: delay, Feedback: feedback, Mix: mix})
+}
+
+// DelayWithOptions adds echoes to the wav file
+func (w *Wav) DelayWithOptions(opts DelayOptions) error {
+	if opts.Time <= 0 {
+		return errors.New("delay time must be greater than 0")
+	}
+	if !(opts.Feedback >= 0 && opts.Feedback < 1) {
+		return errors.New("feedback must be at least 0 and less than 1")
+	}
+
+	line := delayLine{
+		delay: float64(util.MaxInt(w.frameAt(opts.Time), 1)),
+		feedback: opts.Feedback,
+		mix: opts.Mix,
+	}
+	return w.applyDelayLine(line, opts.ExtendTail)
+}
+
+// Chorus thickens the wav file by mixing in a copy of it that's delayed by a
+// slowly changing amount, making it sound like several performers. Each channel
+// sweeps out of step with the others, which widens stereo audio.
+func (w *Wav) Chorus(opts ChorusOptions) error {
+	if opts.Delay <= 0 || opts.Depth < 0 {
+		return errors.New("delay must be greater than 0, and depth can't be negative")
+	}
+
+	line := delayLine{
+		delay: w.exactFrames(opts.Delay),
+		depth: w.exactFrames(opts.Depth),
+		rate: opts.Rate,
+		mix: opts.Mix,
+	}
+	return w.applyDelayLine(line, opts.ExtendTail)
+}
+
+// Flanger mixes the wav file with a copy of itself delayed by a very short,
+// sweeping amount, giving the jet-like whoosh of a comb filter moving through
+// the audio. Each channel sweeps out of step with the others.
+func (w *Wav) Flanger(opts FlangerOptions) error {
+	if opts.Delay < 0 || opts.Depth < 0 {
+		return errors.New("delay and depth can't be negative")
+	}
+	if !(opts.Feedback > -1 && opts.Feedback < 1) {
+		return errors.New("feedback must be between -1 and 1")
+	}
+
+	line := delayLine{
+		delay: w.exactFrames(opts.Delay),
+		depth: w.exactFrames(opts.Depth),
+		rate: opts.Rate,
+		feedback: opts.Feedback,
+		mix: opts.Mix,
+	}
+	return w.applyDelayLine(line, opts.ExtendTail)
+}
+
+// Tremolo makes the level of the wav file rise and fall `rate` times a second.
+// `depth` is how far the level falls, from 0 (not at all) to 1 (to silence).
+func (w *Wav) Tremolo(rate, depth float64) error {
+	if !(rate > 0) || math.IsInf(rate, 0) {
+		return errors.New("rate must be greater than 0")
+	}
+	if !(depth >= 0 && depth <= 1) {
+		return errors.New("depth must be between 0 and 1")
+	}
+
+	samples, err := w.Float64Samples()
+	if err != nil {
+		return err
+	}
+
+	for i := 0; i < samples.Frames(); i++ {
+		phase := 2 * math.Pi * rate * float64(i) / float64(w.SampleRate)
+		gain := 1 - depth * (1 - math.Cos(phase)) / 2
+		for c := range samples {
+			samples[c][i] *= gain
+		}
+	}
+
+	return w.SetFromFloat64(samples)
+}
+
+// exactFrames converts `d` into a number of frames, without rounding
+func (w *Wav) exactFrames(d time.Duration) float64 {
+	return d.Seconds() * float64(w.SampleRate)
+}
+
+// delayLine is a delay whose length can be swept by a sine wave, with
+// feedback, which is the basis of the delay, chorus and flanger effects.
+// Times are measured in frames.
+type delayLine struct {
+	// The delay sweeps between `delay` and `delay + depth`, `rate` times a
+	// second
+	delay float64
+	depth float64
+	rate float64
+
+	feedback float64
+	mix float64
+}
+
+// tail returns how many frames the delayed audio carries on for after the
+// input ends
+func (l delayLine) tail() int {
+	echoes := 1.0
+	if l.feedback != 0 {
+		echoes += math.Ceil(-effectTailRange / 20 / math.Log10(math.Abs(l.feedback)))
+	}
+
+	return int(math.Ceil((l.delay + l.depth) * echoes))
+}
+
+// applyDelayLine runs every channel of the wav file through `line`, optionally
+// lengthening it by the line's tail
+func (w *Wav) applyDelayLine(line delayLine, extendTail bool) error {
+	if !(line.mix >= 0 && line.mix <= 1) {
+		return errors.New("mix must be between 0 and 1")
+	}
+	if line.depth > 0 && !(line.rate > 0 && !math.IsInf(line.rate, 0)) {
+		return errors.New("rate must be greater than 0")
+	}
+
+	samples, err := w.Float64Samples()
+	if err != nil {
+		return err
+	}
+
+	frames := samples.Frames()
+	if extendTail {
+		frames += line.tail()
+		if uint64(frames) * uint64(w.DataBlockSize) > math.MaxUint32 {
+			return errors.New("resulting data size would be too large (> max uint32)")
+		}
+	}
+
+	processed := NewBuffer[float64](samples.Channels(), frames)
+	for c := range samples {
+		// Spread the channels' sweeps evenly through the cycle
+		offset := 2 * math.Pi * float64(c) / float64(samples.Channels())
+
+		// The line holds the input plus whatever is fed back into it
+		held := make([]float64, frames)
+		for i := range held {
+			delay := line.delay
+			if line.depth > 0 {
+				phase := 2 * math.Pi * line.rate * float64(i) / float64(w.SampleRate) + offset
+				delay += line.depth * (1 - math.Cos(phase)) / 2
+			}
+
+			// The delay can't be shorter than a frame, since the line's
+			// current value depends on what it's delayed by
+			delayed := interpolateAt(held, float64(i) - math.Max(delay, 1))
+			input := sampleAt(samples[c], i)
+			held[i] = input + line.feedback * delayed
+			processed[c][i] = (1 - line.mix) * input + line.mix * delayed
+		}
+	}
+
+	return w.SetFromFloat64(processed)
+}
+
+// interpolateAt returns the value of `samples` at a fractional `position`,
+// interpolating linearly between the samples either side. Positions outside of
+// `samples` are 0.
+func interpolateAt(samples []float64, position float64) float64 {
+	i := math.Floor(position)
+	fraction := position - i
+
+	return sampleAt(samples, int(i)) * (1 - fraction) + sampleAt(samples, int(i) + 1) * fraction
+}
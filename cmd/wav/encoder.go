@@ -0,0 +1,331 @@
+package wav
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/liamcr/wavy/internal/util"
+)
+
+// UnknownDataSize is written in place of the RIFF and data chunk sizes when
+// the length of the audio isn't known up front. Encoders writing to outputs
+// that can't be seeked (pipes, network connections, HTTP responses etc.) use
+// it, since they have no way of going back to fill in the real sizes. Decoders
+// treat a data chunk of this size as running to the end of the input.
+const UnknownDataSize uint32 = math.MaxUint32
+
+// Encoder writes a wav file incrementally, so that audio can be produced on
+// the fly without holding all of its samples in memory.
+type Encoder struct {
+	output io.Writer
+	format Format
+
+	// seeker is used to patch the chunk sizes once the encoder is closed. It
+	// is nil when the output can't be seeked
+	seeker io.Seeker
+
+	// start is the position in the output where the wav file begins
+	start int64
+
+	// dataSize is the number of bytes of audio data written so far
+	dataSize uint64
+
+	// buffer holds the encoded bytes of the frames being written, and is
+	// reused between calls to Write
+	buffer []byte
+
+	closed bool
+}
+
+// NewEncoder writes the header of a wav file with the given format to
+// `output`, after which the sample data can be written in blocks with `Write`.
+// The DataBlockSize and DataRate of the format are derived from its other
+// fields.
+//
+// If `output` implements io.Seeker, the RIFF and data chunk sizes are filled
+// in when the encoder is closed. Otherwise both are written as
+// UnknownDataSize.
+func NewEncoder(output io.Writer, format Format) (*Encoder, error) {
+	if err := format.validate(); err != nil {
+		return nil, err
+	}
+	if format.Channels == 0 {
+		return nil, errors.New("format must have at least 1 channel")
+	}
+
+	format.DataBlockSize = format.Channels * (format.BitsPerSample / 8)
+	format.DataRate = format.SampleRate * uint32(format.DataBlockSize)
+
+	encoder := &Encoder{output: output, format: format}
+
+	// Outputs such as pipes implement io.Seeker but fail when used, so make
+	// sure seeking actually works before relying on it
+	if seeker, ok := output.(io.Seeker); ok {
+		if start, err := seeker.Seek(0, io.SeekCurrent); err == nil {
+			encoder.seeker = seeker
+			encoder.start = start
+		}
+	}
+
+	dataSize := UnknownDataSize
+	if encoder.seeker != nil {
+		dataSize = 0
+	}
+
+	if _, err := output.Write(appendHeader([]byte{}, format, dataSize)); err != nil {
+		return nil, err
+	}
+
+	return encoder, nil
+}
+
+// Format returns the format of the wav being written
+func (e *Encoder) Format() Format {
+	return e.format
+}
+
+// Write encodes the samples in `frames` and writes them to the output. Each
+// sample must have the type that Decode would produce for the encoder's
+// format (e.g. int16 for 16-bit PCM, float32 for 32-bit float).
+func (e *Encoder) Write(frames []SampleGroup) error {
+	if e.closed {
+		return errors.New("cannot write to a closed encoder")
+	}
+
+	if err := e.checkSize(len(frames)); err != nil {
+		return err
+	}
+
+	encoded, err := appendSampleGroups(e.buffer[:0], frames, e.format)
+	if err != nil {
+		return err
+	}
+
+	return e.writeEncoded(encoded)
+}
+
+// WriteBuffer encodes the samples in `buffer` and writes them to the output,
+// without boxing each sample. T must be the type that Decode would produce for
+// the encoder's format (e.g. int16 for 16-bit PCM), and the buffer must have
+// one slice per channel.
+func WriteBuffer[T Sample](e *Encoder, buffer Buffer[T]) error {
+	if e.closed {
+		return errors.New("cannot write to a closed encoder")
+	}
+	if sampleTypeFor[T]() != sampleTypeOf(e.format) {
+		var zero T
+		return fmt.Errorf("can't encode a buffer of %T as %v-bit samples", zero, e.format.BitsPerSample)
+	}
+	if buffer.Channels() != int(e.format.Channels) {
+		return fmt.Errorf("buffer has %v channels, expected %v", buffer.Channels(), e.format.Channels)
+	}
+	if err := e.checkSize(buffer.Frames()); err != nil {
+		return err
+	}
+
+	encoded := e.buffer[:0]
+	bytesPerSample := int(e.format.BitsPerSample) / 8
+	isFloat := e.format.isFloat()
+	for i := 0; i < buffer.Frames(); i++ {
+		for c := range buffer {
+			v := buffer[c][i]
+			switch {
+			case isFloat && bytesPerSample == 4:
+				encoded = append(encoded, util.Float32ToBytes(float32(v))...)
+			case isFloat:
+				encoded = append(encoded, util.Float64ToBytes(float64(v))...)
+			case bytesPerSample == 1:
+				encoded = append(encoded, byte(v))
+			case bytesPerSample == 2:
+				encoded = append(encoded, util.UInt16ToBytes(uint16(v))...)
+			case bytesPerSample == 3:
+				encoded = append(encoded, util.Int24ToBytes(int32(v))...)
+			case bytesPerSample == 4:
+				encoded = append(encoded, util.UInt32ToBytes(uint32(v))...)
+			default:
+				encoded = append(encoded, util.UInt64ToBytes(uint64(v))...)
+			}
+		}
+	}
+
+	return e.writeEncoded(encoded)
+}
+
+// checkSize makes sure that writing another `frames` sample groups won't
+// overflow the data chunk
+func (e *Encoder) checkSize(frames int) error {
+	numBytes := uint64(frames) * uint64(e.format.DataBlockSize)
+	if e.dataSize + numBytes >= uint64(UnknownDataSize) {
+		return errors.New("resulting data size would be too large (> max uint32)")
+	}
+
+	return nil
+}
+
+// writeEncoded writes encoded sample data to the output, keeping hold of the
+// byte slice so it can be reused by the next write
+func (e *Encoder) writeEncoded(encoded []byte) error {
+	e.buffer = encoded
+
+	if _, err := e.output.Write(encoded); err != nil {
+		return err
+	}
+	e.dataSize += uint64(len(encoded))
+
+	return nil
+}
+
+// Close finishes the wav file, writing the pad byte required after odd sized
+// data chunks and, when the output is seekable, filling in the RIFF and data
+// chunk sizes. Close does not close the underlying output.
+func (e *Encoder) Close() error {
+	if e.closed {
+		return nil
+	}
+	e.closed = true
+
+	if e.dataSize % 2 == 1 {
+		if _, err := e.output.Write([]byte{0}); err != nil {
+			return err
+		}
+	}
+
+	if e.seeker == nil {
+		return nil
+	}
+
+	header := appendHeader([]byte{}, e.format, uint32(e.dataSize))
+
+	end, err := e.seeker.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	if _, err := e.seeker.Seek(e.start, io.SeekStart); err != nil {
+		return err
+	}
+	if _, err := e.output.Write(header); err != nil {
+		return err
+	}
+	_, err = e.seeker.Seek(end, io.SeekStart)
+	return err
+}
+
+// appendHeader appends the RIFF header, the fmt chunk and the data chunk
+// header of a wav file with the given format and data size to `output`
+func appendHeader(output []byte, format Format, dataSize uint32) []byte {
+	extensible := format.needsExtensibleFmt()
+	fmtChunkSize := uint32(fmtSize)
+	if extensible {
+		fmtChunkSize = extensibleFmtSize
+	}
+
+	// The RIFF size covers everything after the RIFF chunk header: the "WAVE"
+	// identifier plus the fmt and data chunks, including the data chunk's pad
+	// byte
+	fileSize := UnknownDataSize
+	if dataSize != UnknownDataSize {
+		fileSize = 2 * chunkHeadingSize + fmtChunkSize + dataSize + dataSize % 2 + 4
+	}
+
+	output = append(output, "RIFF"...)
+	output = append(output, util.UInt32ToBytes(fileSize)...)
+	output = append(output, "WAVE"...)
+
+	// fmt chunk is 16 bytes long, or 40 bytes long when extensible
+	output = append(output, "fmt "...)
+	output = append(output, util.UInt32ToBytes(fmtChunkSize)...)
+	if extensible {
+		output = append(output, util.UInt16ToBytes(ExtensibleFormat)...)
+	} else {
+		output = append(output, util.UInt16ToBytes(format.FormatType)...)
+	}
+	output = append(output, util.UInt16ToBytes(format.Channels)...)
+	output = append(output, util.UInt32ToBytes(format.SampleRate)...)
+	output = append(output, util.UInt32ToBytes(format.DataRate)...)
+	output = append(output, util.UInt16ToBytes(format.DataBlockSize)...)
+	output = append(output, util.UInt16ToBytes(format.BitsPerSample)...)
+
+	if extensible {
+		validBitsPerSample := format.ValidBitsPerSample
+		if validBitsPerSample == 0 {
+			validBitsPerSample = format.BitsPerSample
+		}
+		subFormat := format.SubFormat
+		if format.FormatType != ExtensibleFormat {
+			subFormat = subFormatGUID(format.FormatType)
+		}
+
+		output = append(output, util.UInt16ToBytes(extensionSize)...)
+		output = append(output, util.UInt16ToBytes(validBitsPerSample)...)
+		output = append(output, util.UInt32ToBytes(format.ChannelMask)...)
+		output = append(output, subFormat[:]...)
+	}
+
+	output = append(output, "data"...)
+	output = append(output, util.UInt32ToBytes(dataSize)...)
+
+	return output
+}
+
+// appendSampleGroups encodes the samples in `frames` according to the given
+// format and appends them to `output`
+func appendSampleGroups(output []byte, frames []SampleGroup, format Format) ([]byte, error) {
+	isFloat := format.isFloat()
+	for _, sampleGroup := range(frames) {
+		if len(sampleGroup.ChannelData) != int(format.Channels) {
+			return nil, fmt.Errorf("sample group has %v channels, expected %v", len(sampleGroup.ChannelData), format.Channels)
+		}
+
+		for _, sample := range(sampleGroup.ChannelData) {
+			if isFloat {
+				if format.BitsPerSample == uint16(32) {
+					thirtyTwoBitSample, ok := sample.(float32)
+					if !ok {
+						return nil, fmt.Errorf("can't cast data point %v to float32", sample)
+					}
+					output = append(output, util.Float32ToBytes(thirtyTwoBitSample)...)
+				} else if format.BitsPerSample == uint16(64) {
+					sixtyFourBitSample, ok := sample.(float64)
+					if !ok {
+						return nil, fmt.Errorf("can't cast data point %v to float64", sample)
+					}
+					output = append(output, util.Float64ToBytes(sixtyFourBitSample)...)
+				}
+			} else if format.BitsPerSample == uint16(8) {
+				eightBitSample, ok := sample.(uint8)
+				if !ok {
+					return nil, fmt.Errorf("can't cast data point %v to byte", sample)
+				}
+				output = append(output, byte(eightBitSample))
+			} else if format.BitsPerSample == uint16(16) {
+				sixteenBitSample, ok := sample.(int16)
+				if !ok {
+					return nil, fmt.Errorf("can't cast data point %v to int16", sample)
+				}
+				output = append(output, util.UInt16ToBytes(uint16(sixteenBitSample))...)
+			} else if format.BitsPerSample == uint16(24) {
+				twentyFourBitSample, ok := sample.(int32)
+				if !ok {
+					return nil, fmt.Errorf("can't cast data point %v to int32", sample)
+				}
+				output = append(output, util.Int24ToBytes(twentyFourBitSample)...)
+			} else if format.BitsPerSample == uint16(32) {
+				thirtyTwoBitSample, ok := sample.(int32)
+				if !ok {
+					return nil, fmt.Errorf("can't cast data point %v to int32", sample)
+				}
+				output = append(output, util.UInt32ToBytes(uint32(thirtyTwoBitSample))...)
+			} else if format.BitsPerSample == uint16(64) {
+				sixtyFourBitSample, ok := sample.(int64)
+				if !ok {
+					return nil, fmt.Errorf("can't cast data point %v to int64", sample)
+				}
+				output = append(output, util.UInt64ToBytes(uint64(sixtyFourBitSample))...)
+			}
+		}
+	}
+
+	return output, nil
+}
@@ -0,0 +1,128 @@
+package wav
+
+import (
+	"errors"
+	"math"
+	"time"
+)
+
+// Curve is the shape of a fade, describing how the gain changes over its
+// duration
+type Curve int
+
+const (
+	// LinearCurve changes the gain at a constant rate
+	LinearCurve Curve = iota
+
+	// ExponentialCurve changes the level in decibels at a constant rate, so
+	// fades in start slowly and fades out drop away quickly. It sounds the
+	// most even to the ear.
+	ExponentialCurve
+
+	// LogarithmicCurve is the opposite of ExponentialCurve: fades in rise
+	// quickly, and fades out linger before dropping away
+	LogarithmicCurve
+
+	// SCurve changes the gain slowly at either end of the fade and quickly in
+	// the middle
+	SCurve
+
+	// EqualPowerCurve follows a quarter sine wave. When two equal power fades
+	// are crossfaded, the total power of the signal stays constant.
+	EqualPowerCurve
+)
+
+// curveRange is the range, in decibels, of ExponentialCurve and
+// LogarithmicCurve. Their gains are rescaled slightly so that they still start
+// from silence.
+const curveRange = 60.0
+
+// FadeIn fades the start of the wav file in from silence over the duration
+// `d`, following the given curve
+func (w *Wav) FadeIn(d time.Duration, curve Curve) error {
+	if !curve.valid() {
+		return errors.New("unknown fade curve")
+	}
+
+	_, frames, err := w.frameRange(0, d)
+	if err != nil {
+		return err
+	}
+
+	return w.applyGain(0, frames, func(i int) float64 {
+		return curve.gain(float64(i) / float64(frames))
+	})
+}
+
+// FadeOut fades the end of the wav file out to silence over the duration `d`,
+// following the given curve
+func (w *Wav) FadeOut(d time.Duration, curve Curve) error {
+	if !curve.valid() {
+		return errors.New("unknown fade curve")
+	}
+
+	_, frames, err := w.frameRange(0, d)
+	if err != nil {
+		return err
+	}
+
+	start := len(w.Data) - frames
+	return w.applyGain(start, len(w.Data), func(i int) float64 {
+		return curve.gain(float64(frames - 1 - i) / float64(frames))
+	})
+}
+
+// applyGain multiplies every sample in the sample groups from `start` to `end`
+// by `gain(i)`, where i counts from 0 at `start`. Only the samples in the
+// range are converted, so fades stay cheap on long files.
+func (w *Wav) applyGain(start, end int, gain func(i int) float64) error {
+	if start == end {
+		return nil
+	}
+
+	section := *w
+	section.Data = w.Data[start:end]
+	samples, err := section.Float64Samples()
+	if err != nil {
+		return err
+	}
+
+	for i := 0; i < samples.Frames(); i++ {
+		g := gain(i)
+		for c := range samples {
+			samples[c][i] *= g
+		}
+	}
+
+	if err := section.SetFromFloat64(samples); err != nil {
+		return err
+	}
+	copy(w.Data[start:end], section.Data)
+
+	return nil
+}
+
+// valid reports whether the curve is one of the defined curves
+func (c Curve) valid() bool {
+	return c >= LinearCurve && c <= EqualPowerCurve
+}
+
+// gain returns the gain of the curve at position `x` of a fade in, where 0 is
+// the start of the fade and 1 is the end
+func (c Curve) gain(x float64) float64 {
+	x = math.Max(0, math.Min(1, x))
+	floor := math.Pow(10, -curveRange / 20)
+
+	switch c {
+	case ExponentialCurve:
+		return (math.Pow(10, curveRange * (x - 1) / 20) - floor) / (1 - floor)
+	case LogarithmicCurve:
+		return 1 - (math.Pow(10, -curveRange * x / 20) - floor) / (1 - floor)
+	case SCurve:
+		return 0.5 - 0.5 * math.Cos(math.Pi * x)
+	case EqualPowerCurve:
+		return math.Sin(math.Pi / 2 * x)
+	}
+
+	return x
+}
@@ -0,0 +1,24 @@
+package wav
+
+import (
+	"github.com/liamcr/wavy/cmd/wav/filter"
+)
+
+// ApplyFilter runs every channel of the wav file through `f`. The filter is
+// reset before each channel, so the channels are filtered independently.
+// Samples that end up beyond full scale (e.g. after a boost) are clamped.
+func (w *Wav) ApplyFilter(f filter.Filter) error {
+	samples, err := w.Float64Samples()
+	if err != nil {
+		return err
+	}
+
+	for c := range samples {
+		f.Reset()
+		for i, v := range samples[c] {
+			samples[c][i] = f.Process(v)
+		}
+	}
+
+	return w.SetFromFloat64(samples)
+}
@@ -0,0 +1,210 @@
+package filter
+
+import (
+	"errors"
+	"math"
+)
+
+// Biquad is a second order IIR filter, in direct form I. The coefficients are
+// normalized so that a0 is 1. The constructors below design biquads using the
+// formulas from Robert Bristow-Johnson's Audio EQ Cookbook, but any
+// coefficients can be used.
+type Biquad struct {
+	B0, B1, B2, A1, A2 float64
+
+	x1, x2, y1, y2 float64
+}
+
+// Process filters the next sample
+func (f *Biquad) Process(x float64) float64 {
+	y := f.B0 * x + f.B1 * f.x1 + f.B2 * f.x2 - f.A1 * f.y1 - f.A2 * f.y2
+	f.x2, f.x1 = f.x1, x
+	f.y2, f.y1 = f.y1, y
+
+	return y
+}
+
+// Reset clears the filter's memory of previous samples
+func (f *Biquad) Reset() {
+	f.x1, f.x2, f.y1, f.y2 = 0, 0, 0, 0
+}
+
+// NewLowPass creates a filter that passes frequencies below `frequency` Hz and
+// cuts those above it by 12 dB per octave. `q` sets the resonance at the
+// cutoff: 1/√2 gives the flattest passband.
+func NewLowPass(sampleRate uint32, frequency, q float64) (*Biquad, error) {
+	cos, alpha, err := prepare(sampleRate, frequency, q)
+	if err != nil {
+		return nil, err
+	}
+
+	return normalize(
+		(1 - cos) / 2, 1 - cos, (1 - cos) / 2,
+		1 + alpha, -2 * cos, 1 - alpha,
+	), nil
+}
+
+// NewHighPass creates a filter that passes frequencies above `frequency` Hz and
+// cuts those below it by 12 dB per octave. `q` sets the resonance at the
+// cutoff: 1/√2 gives the flattest passband.
+func NewHighPass(sampleRate uint32, frequency, q float64) (*Biquad, error) {
+	cos, alpha, err := prepare(sampleRate, frequency, q)
+	if err != nil {
+		return nil, err
+	}
+
+	return normalize(
+		(1 + cos) / 2, -(1 + cos), (1 + cos) / 2,
+		1 + alpha, -2 * cos, 1 - alpha,
+	), nil
+}
+
+// NewBandPass creates a filter that passes frequencies around `frequency` Hz,
+// at their original level, and cuts those either side. Higher values of `q`
+// give a narrower band.
+func NewBandPass(sampleRate uint32, frequency, q float64) (*Biquad, error) {
+	cos, alpha, err := prepare(sampleRate, frequency, q)
+	if err != nil {
+		return nil, err
+	}
+
+	return normalize(
+		alpha, 0, -alpha,
+		1 + alpha, -2 * cos, 1 - alpha,
+	), nil
+}
+
+// NewNotch creates a filter that removes frequencies around `frequency` Hz,
+// e.g. mains hum at 50 or 60 Hz, leaving the rest. Higher values of `q` give a
+// narrower notch.
+func NewNotch(sampleRate uint32, frequency, q float64) (*Biquad, error) {
+	cos, alpha, err := prepare(sampleRate, frequency, q)
+	if err != nil {
+		return nil, err
+	}
+
+	return normalize(
+		1, -2 * cos, 1,
+		1 + alpha, -2 * cos, 1 - alpha,
+	), nil
+}
+
+// NewPeaking creates a filter that boosts or cuts frequencies around
+// `frequency` Hz by `gainDB` decibels. Higher values of `q` affect a narrower
+// band.
+func NewPeaking(sampleRate uint32, frequency, q, gainDB float64) (*Biquad, error) {
+	cos, alpha, err := prepare(sampleRate, frequency, q)
+	if err != nil {
+		return nil, err
+	}
+	if math.IsNaN(gainDB) || math.IsInf(gainDB, 0) {
+		return nil, errors.New("gain must be a finite number of decibels")
+	}
+
+	a := math.Pow(10, gainDB / 40)
+	return normalize(
+		1 + alpha * a, -2 * cos, 1 - alpha * a,
+		1 + alpha / a, -2 * cos, 1 - alpha / a,
+	), nil
+}
+
+// NewLowShelf creates a filter that boosts or cuts frequencies below
+// `frequency` Hz by `gainDB` decibels. `slope` sets how steeply the filter
+// moves between the two levels: 1 is as steep as it can be without overshoot.
+func NewLowShelf(sampleRate uint32, frequency, gainDB, slope float64) (*Biquad, error) {
+	a, cos, alpha, err := prepareShelf(sampleRate, frequency, gainDB, slope)
+	if err != nil {
+		return nil, err
+	}
+
+	root := 2 * math.Sqrt(a) * alpha
+	return normalize(
+		a * ((a + 1) - (a - 1) * cos + root),
+		2 * a * ((a - 1) - (a + 1) * cos),
+		a * ((a + 1) - (a - 1) * cos - root),
+		(a + 1) + (a - 1) * cos + root,
+		-2 * ((a - 1) + (a + 1) * cos),
+		(a + 1) + (a - 1) * cos - root,
+	), nil
+}
+
+// NewHighShelf creates a filter that boosts or cuts frequencies above
+// `frequency` Hz by `gainDB` decibels. `slope` sets how steeply the filter
+// moves between the two levels: 1 is as steep as it can be without overshoot.
+func NewHighShelf(sampleRate uint32, frequency, gainDB, slope float64) (*Biquad, error) {
+	a, cos, alpha, err := prepareShelf(sampleRate, frequency, gainDB, slope)
+	if err != nil {
+		return nil, err
+	}
+
+	root := 2 * math.Sqrt(a) * alpha
+	return normalize(
+		a * ((a + 1) + (a - 1) * cos + root),
+		-2 * a * ((a - 1) + (a + 1) * cos),
+		a * ((a + 1) + (a - 1) * cos - root),
+		(a + 1) - (a - 1) * cos + root,
+		2 * ((a - 1) - (a + 1) * cos),
+		(a + 1) - (a - 1) * cos - root,
+	), nil
+}
+
+// prepare checks a filter's settings, and returns the cosine of its angular
+// frequency and the alpha term used by the cookbook formulas
+func prepare(sampleRate uint32, frequency, q float64) (float64, float64, error) {
+	w0, err := angularFrequency(sampleRate, frequency)
+	if err != nil {
+		return 0, 0, err
+	}
+	if !(q > 0) || math.IsInf(q, 0) {
+		return 0, 0, errors.New("q must be greater than 0")
+	}
+
+	return math.Cos(w0), math.Sin(w0) / (2 * q), nil
+}
+
+// prepareShelf checks a shelving filter's settings, and returns the amplitude,
+// cosine and alpha terms used by the cookbook formulas
+func prepareShelf(sampleRate uint32, frequency, gainDB, slope float64) (float64, float64, float64, error) {
+	w0, err := angularFrequency(sampleRate, frequency)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	if math.IsNaN(gainDB) || math.IsInf(gainDB, 0) {
+		return 0, 0, 0, errors.New("gain must be a finite number of decibels")
+	}
+	if !(slope > 0) || math.IsInf(slope, 0) {
+		return 0, 0, 0, errors.New("slope must be greater than 0")
+	}
+
+	a := math.Pow(10, gainDB / 40)
+	shape := (a + 1 / a) * (1 / slope - 1) + 2
+	if shape < 0 {
+		return 0, 0, 0, errors.New("slope is too steep for the gain")
+	}
+
+	return a, math.Cos(w0), math.Sin(w0) / 2 * math.Sqrt(shape), nil
+}
+
+// angularFrequency returns `frequency` in radians per sample, checking that
+// it's below the Nyquist frequency
+func angularFrequency(sampleRate uint32, frequency float64) (float64, error) {
+	if sampleRate == 0 {
+		return 0, errors.New("sample rate must be greater than 0")
+	}
+	if !(frequency > 0 && frequency < float64(sampleRate) / 2) {
+		return 0, errors.New("frequency must be between 0 and half the sample rate")
+	}
+
+	return 2 * math.Pi * frequency / float64(sampleRate), nil
+}
+
+// normalize creates a biquad from its coefficients, dividing them all by a0
+func normalize(b0, b1, b2, a0, a1, a2 float64) *Biquad {
+	return &Biquad{
+		B0: b0 / a0,
+		B1: b1 / a0,
+		B2: b2 / a0,
+		A1: a1 / a0,
+		A2: a2 / a0,
+	}
+}
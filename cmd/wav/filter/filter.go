@@ -0,0 +1,101 @@
+package filter
+
+import (
+	"errors"
+	"math"
+)
+
+// Filter processes audio one sample at a time, remembering what it needs of
+// previous samples
+type Filter interface {
+	// Process filters the next sample
+	Process(x float64) float64
+
+	// Reset clears the filter's memory of previous samples, so that it can be
+	// used on a new signal
+	Reset()
+}
+
+// Cascade is a chain of filters, each one filtering the output of the one
+// before. Cascading filters makes their slopes steeper, e.g. two 12 dB per
+// octave low passes make one of 24 dB per octave, and combines their effects,
+// e.g. a high pass and low pass make a band pass.
+type Cascade []Filter
+
+// Process filters the next sample through every filter in turn
+func (c Cascade) Process(x float64) float64 {
+	for _, f := range c {
+		x = f.Process(x)
+	}
+
+	return x
+}
+
+// Reset resets every filter in the cascade
+func (c Cascade) Reset() {
+	for _, f := range c {
+		f.Reset()
+	}
+}
+
+// NewButterworthLowPass creates a low pass filter with a maximally flat
+// passband, cutting frequencies above `frequency` Hz by 6 dB per octave for
+// each order
+func NewButterworthLowPass(sampleRate uint32, frequency float64, order int) (Cascade, error) {
+	return newButterworth(sampleRate, frequency, order, NewLowPass, firstOrderLowPass)
+}
+
+// NewButterworthHighPass creates a high pass filter with a maximally flat
+// passband, cutting frequencies below `frequency` Hz by 6 dB per octave for
+// each order
+func NewButterworthHighPass(sampleRate uint32, frequency float64, order int) (Cascade, error) {
+	return newButterworth(sampleRate, frequency, order, NewHighPass, firstOrderHighPass)
+}
+
+// newButterworth builds a Butterworth filter of the given order from second
+// order sections, plus a first order section for odd orders. Each section's q
+// places its poles evenly around the unit circle, as the Butterworth design
+// needs.
+func newButterworth(
+	sampleRate uint32,
+	frequency float64,
+	order int,
+	secondOrder func(uint32, float64, float64) (*Biquad, error),
+	firstOrder func(float64) *Biquad,
+) (Cascade, error) {
+	if order < 1 {
+		return nil, errors.New("order must be at least 1")
+	}
+
+	cascade := Cascade{}
+	for k := 0; k < order / 2; k++ {
+		q := 1 / (2 * math.Sin(float64(2 * k + 1) * math.Pi / float64(2 * order)))
+		section, err := secondOrder(sampleRate, frequency, q)
+		if err != nil {
+			return nil, err
+		}
+		cascade = append(cascade, section)
+	}
+
+	if order % 2 == 1 {
+		w0, err := angularFrequency(sampleRate, frequency)
+		if err != nil {
+			return nil, err
+		}
+		cascade = append(cascade, firstOrder(math.Tan(w0 / 2)))
+	}
+
+	return cascade, nil
+}
+
+// firstOrderLowPass creates a 6 dB per octave low pass, where `k` is the
+// prewarped cutoff frequency
+func firstOrderLowPass(k float64) *Biquad {
+	return normalize(k, k, 0, 1 + k, k - 1, 0)
+}
+
+// firstOrderHighPass creates a 6 dB per octave high pass, where `k` is the
+// prewarped cutoff frequency
+func firstOrderHighPass(k float64) *Biquad {
+	return normalize(1, -1, 0, 1 + k, k - 1, 0)
+}
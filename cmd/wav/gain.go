@@ -0,0 +1,77 @@
+package wav
+
+import (
+	"errors"
+	"math"
+)
+
+// ApplyGain changes the level of the wav file by `db` decibels. Samples pushed
+// beyond full scale are clamped (saturated) for integer formats, and returned
+// as true. IEEE float samples aren't clamped, but going beyond full scale still
+// counts as clipping, since it will clip when played or converted.
+func (w *Wav) ApplyGain(db float64) (bool, error) {
+	if math.IsNaN(db) || math.IsInf(db, 0) {
+		return false, errors.New("gain must be a finite number of decibels")
+	}
+
+	samples, err := w.Float64Samples()
+	if err != nil {
+		return false, err
+	}
+
+	return w.setScaled(samples, math.Pow(10, db / 20))
+}
+
+// NormalizePeak changes the level of the wav file so that its loudest sample
+// peaks at `targetDBFS` (e.g. -1 for 1 dB below full scale). Like ApplyGain, it
+// returns whether any samples clipped, which can only happen for targets above
+// 0 dBFS. Silent wavs are left unchanged.
+func (w *Wav) NormalizePeak(targetDBFS float64) (bool, error) {
+	if math.IsNaN(targetDBFS) || math.IsInf(targetDBFS, 0) {
+		return false, errors.New("target must be a finite number of decibels")
+	}
+
+	samples, err := w.Float64Samples()
+	if err != nil {
+		return false, err
+	}
+
+	peak := samplePeak(samples)
+	if peak == 0 {
+		return false, nil
+	}
+
+	return w.setScaled(samples, math.Pow(10, targetDBFS / 20) / peak)
+}
+
+// setScaled multiplies `samples` by `gain` and stores them in the wav,
+// reporting whether any of them went beyond full scale
+func (w *Wav) setScaled(samples Buffer[float64], gain float64) (bool, error) {
+	for c := range samples {
+		for i := range samples[c] {
+			samples[c][i] *= gain
+		}
+	}
+
+	// Float samples aren't clamped, so check for clipping before storing them
+	clipped := w.isFloat() && samplePeak(samples) > 1
+
+	clampedSamples, err := w.setFromFloat64(samples)
+	if err != nil {
+		return false, err
+	}
+
+	return clipped || clampedSamples > 0, nil
+}
+
+// samplePeak returns the largest magnitude of any sample in `samples`
+func samplePeak(samples Buffer[float64]) float64 {
+	peak := 0.0
+	for c := range samples {
+		for _, v := range samples[c] {
+			peak = math.Max(peak, math.Abs(v))
+		}
+	}
+
+	return peak
+}
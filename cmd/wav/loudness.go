@@ -0,0 +1,341 @@
+package wav
+
+import (
+	"errors"
+	"math"
+	"math/bits"
+	"sort"
+
+	"github.com/liamcr/wavy/cmd/wav/filter"
+	"github.com/liamcr/wavy/internal/util"
+)
+
+const (
+	// absoluteGate is the loudness, in LUFS, below which blocks are ignored
+	// when measuring integrated loudness and loudness range
+	absoluteGate = -70.0
+
+	// integratedRelativeGate is how far below the ungated loudness, in LU, a
+	// block can be before it's ignored by the integrated loudness
+	integratedRelativeGate = -10.0
+
+	// rangeRelativeGate is how far below the ungated loudness, in LU, a
+	// block can be before it's ignored by the loudness range
+	rangeRelativeGate = -20.0
+
+	// surroundWeight is the weighting given to surround channels, roughly
+	// +1.5 dB
+	surroundWeight = 1.41
+
+	// Speaker positions used in channel masks
+	speakerLowFrequency = 0x8
+	speakerBackLeft = 0x10
+	speakerBackRight = 0x20
+	speakerBackCenter = 0x100
+	speakerSideLeft = 0x200
+	speakerSideRight = 0x400
+)
+
+// defaultChannelMasks are the speaker positions assumed for wavs with no
+// channel mask, indexed by number of channels
+var defaultChannelMasks = []uint32{
+	0,
+	0x4, // Mono: front centre
+	0x3, // Stereo: front left and right
+	0x7, // Front left, right and centre
+	0x33, // Quad: front and back left and right
+	0x37, // 5.0
+	0x3F, // 5.1
+	0x70F, // 6.1: 5.1 with a back centre, and surrounds at the sides
+	0x63F, // 7.1
+}
+
+// LoudnessStats are measurements of the loudness of audio as defined by ITU-R
+// BS.1770 and EBU R128. Loudness is measured in LUFS (loudness units relative
+// to full scale), where 1 LU is equivalent to 1 dB. Measurements that need
+// more audio than is available (e.g. short-term loudness of a 1 second file)
+// are -Inf.
+type LoudnessStats struct {
+	// Integrated is the gated loudness of the whole file, the figure that
+	// loudness targets like -23 LUFS (EBU R128) or -14 LUFS refer to
+	Integrated float64
+
+	// MaxMomentary is the loudest the audio gets over any 400ms
+	MaxMomentary float64
+
+	// MaxShortTerm is the loudest the audio gets over any 3 seconds
+	MaxShortTerm float64
+
+	// Range is the loudness range (LRA) in LU: the spread between the quiet
+	// and loud parts of the audio, ignoring the extremes
+	Range float64
+
+	// TruePeak is the highest level of the audio's waveform in dBTP,
+	// including peaks that fall between samples
+	TruePeak float64
+}
+
+// Loudness measures the loudness of the wav file. Channels are weighted by
+// their speaker positions (from ChannelMask, or the usual layout for the number
+// of channels if there is none): surround channels are weighted up by 1.5 dB
+// and the LFE channel is ignored.
+func (w *Wav) Loudness() (LoudnessStats, error) {
+	samples, err := w.Float64Samples()
+	if err != nil {
+		return LoudnessStats{}, err
+	}
+
+	// Split the audio into 100ms blocks, and measure the weighted power of
+	// each. Momentary and short-term loudness are taken over 4 and 30 of
+	// these blocks respectively.
+	blockFrames := int(math.Round(float64(w.SampleRate) / 10))
+	if blockFrames == 0 {
+		return LoudnessStats{}, errors.New("sample rate is too low to measure loudness")
+	}
+	blockPowers := kWeightedPowers(samples, w.SampleRate, w.channelWeights(), blockFrames)
+
+	momentary := windowPowers(blockPowers, 4)
+	shortTerm := windowPowers(blockPowers, 30)
+
+	stats := LoudnessStats{
+		Integrated: gatedLoudness(momentary, integratedRelativeGate),
+		MaxMomentary: powerToLoudness(maxPower(momentary)),
+		MaxShortTerm: powerToLoudness(maxPower(shortTerm)),
+		Range: loudnessRange(shortTerm),
+		TruePeak: truePeak(samples, w.SampleRate),
+	}
+
+	return stats, nil
+}
+
+// NormalizeLoudness changes the level of the wav file so that its integrated
+// loudness is `targetLUFS`, without letting its true peak go above
+// `maxTruePeak` dBTP (e.g. -23 and -1 for EBU R128). If reaching the target
+// would push the true peak too high, the wav is only turned up until the true
+// peak reaches `maxTruePeak`, leaving it quieter than the target.
+func (w *Wav) NormalizeLoudness(targetLUFS, maxTruePeak float64) error {
+	if math.IsNaN(targetLUFS) || math.IsInf(targetLUFS, 0) || math.IsNaN(maxTruePeak) || math.IsInf(maxTruePeak, 0) {
+		return errors.New("target loudness and maximum true peak must be finite")
+	}
+
+	stats, err := w.Loudness()
+	if err != nil {
+		return err
+	}
+	if math.IsInf(stats.Integrated, -1) {
+		return errors.New("audio is too short or too quiet to measure its loudness")
+	}
+
+	gain := targetLUFS - stats.Integrated
+	if stats.TruePeak + gain > maxTruePeak {
+		gain = maxTruePeak - stats.TruePeak
+	}
+
+	samples, err := w.Float64Samples()
+	if err != nil {
+		return err
+	}
+
+	_, err = w.setScaled(samples, math.Pow(10, gain / 20))
+	return err
+}
+
+// channelWeights returns the weight given to each of the wav's channels when
+// measuring loudness
+func (w *Wav) channelWeights() []float64 {
+	mask := w.ChannelMask
+	if mask == 0 && int(w.Channels) < len(defaultChannelMasks) {
+		mask = defaultChannelMasks[w.Channels]
+	}
+
+	// Channels are assigned to the speaker positions in the mask in order,
+	// and any channels beyond those in the mask have no position
+	weights := make([]float64, w.Channels)
+	for c := range weights {
+		weights[c] = 1
+		if mask == 0 {
+			continue
+		}
+
+		speaker := uint32(1) << bits.TrailingZeros32(mask)
+		mask &^= speaker
+		switch speaker {
+		case speakerLowFrequency:
+			weights[c] = 0
+		case speakerBackLeft, speakerBackRight, speakerBackCenter, speakerSideLeft, speakerSideRight:
+			weights[c] = surroundWeight
+		}
+	}
+
+	return weights
+}
+
+// kWeightedPowers applies the K-weighting filter to each channel of `samples`,
+// and returns the mean square of every complete block of `blockFrames` frames,
+// summed across the channels using `weights`
+func kWeightedPowers(samples Buffer[float64], sampleRate uint32, weights []float64, blockFrames int) []float64 {
+	powers := make([]float64, samples.Frames() / blockFrames)
+	for c := range samples {
+		if weights[c] == 0 {
+			continue
+		}
+
+		shelf, highPass := kWeightingFilters(float64(sampleRate))
+		for i := range powers {
+			sum := 0.0
+			for _, v := range samples[c][i * blockFrames : (i + 1) * blockFrames] {
+				v = highPass.Process(shelf.Process(v))
+				sum += v * v
+			}
+			powers[i] += weights[c] * sum / float64(blockFrames)
+		}
+	}
+
+	return powers
+}
+
+// windowPowers returns the mean power of every run of `size` consecutive
+// blocks
+func windowPowers(blockPowers []float64, size int) []float64 {
+	if len(blockPowers) < size {
+		return []float64{}
+	}
+
+	windows := make([]float64, len(blockPowers) - size + 1)
+	sum := 0.0
+	for i, power := range blockPowers {
+		sum += power
+		if i >= size {
+			sum -= blockPowers[i - size]
+		}
+		if i >= size - 1 {
+			windows[i - size + 1] = math.Max(sum, 0) / float64(size)
+		}
+	}
+
+	return windows
+}
+
+// gatedLoudness returns the loudness of the windows that are above the
+// absolute gate, and no more than `relativeGate` LU below the loudness of
+// those windows
+func gatedLoudness(windows []float64, relativeGate float64) float64 {
+	gated := gateWindows(windows, relativeGate)
+	if len(gated) == 0 {
+		return math.Inf(-1)
+	}
+
+	return powerToLoudness(util.Mean(gated))
+}
+
+// gateWindows returns the powers of the windows that pass both the absolute
+// gate and the given relative gate
+func gateWindows(windows []float64, relativeGate float64) []float64 {
+	absoluteGated := []float64{}
+	for _, power := range windows {
+		if powerToLoudness(power) > absoluteGate {
+			absoluteGated = append(absoluteGated, power)
+		}
+	}
+	if len(absoluteGated) == 0 {
+		return absoluteGated
+	}
+
+	threshold := powerToLoudness(util.Mean(absoluteGated)) + relativeGate
+	gated := []float64{}
+	for _, power := range absoluteGated {
+		if powerToLoudness(power) > threshold {
+			gated = append(gated, power)
+		}
+	}
+
+	return gated
+}
+
+// loudnessRange returns the spread, in LU, between the 10th and 95th
+// percentiles of the gated short-term loudness, as defined by EBU Tech 3342
+func loudnessRange(shortTerm []float64) float64 {
+	gated := gateWindows(shortTerm, rangeRelativeGate)
+	if len(gated) == 0 {
+		return 0
+	}
+
+	sort.Float64s(gated)
+	percentile := func(p float64) float64 {
+		return powerToLoudness(gated[int(math.Round(p * float64(len(gated) - 1)))])
+	}
+
+	return percentile(0.95) - percentile(0.1)
+}
+
+// truePeak returns the highest level, in dBTP, of the waveform described by
+// `samples`. The audio is oversampled to at least 192 kHz (up to 4 times), so
+// that peaks between samples are found.
+func truePeak(samples Buffer[float64], sampleRate uint32) float64 {
+	oversampling := int(math.Min(4, math.Ceil(192000 / float64(sampleRate))))
+
+	peak := 0.0
+	for c := range samples {
+		channel := Buffer[float64]{samples[c]}
+		if oversampling > 1 {
+			channel = resampleBuffer(channel, 1 / float64(oversampling), samples.Frames() * oversampling, DefaultQuality)
+		}
+		peak = math.Max(peak, samplePeak(channel))
+	}
+
+	return 20 * math.Log10(peak)
+}
+
+// powerToLoudness converts a weighted mean square into LUFS
+func powerToLoudness(power float64) float64 {
+	return -0.691 + 10 * math.Log10(power)
+}
+
+// maxPower returns the largest of `powers`, or 0 if there are none
+func maxPower(powers []float64) float64 {
+	max := 0.0
+	for _, power := range powers {
+		max = math.Max(max, power)
+	}
+
+	return max
+}
+
+// kWeightingFilters returns the two stages of the K-weighting filter from
+// BS.1770 for the given sample rate: a high shelf modelling the acoustic
+// effect of the head, and a high pass that ignores the lowest frequencies.
+// The standard only gives coefficients at 48 kHz, so they're derived from the
+// analogue prototypes of those filters.
+func kWeightingFilters(sampleRate float64) (*filter.Biquad, *filter.Biquad) {
+	const (
+		shelfFrequency = 1681.974450955533
+		shelfGain = 3.999843853973347
+		shelfQ = 0.7071752369554196
+		highPassFrequency = 38.13547087602444
+		highPassQ = 0.5003270373238773
+	)
+
+	k := math.Tan(math.Pi * shelfFrequency / sampleRate)
+	vh := math.Pow(10, shelfGain / 20)
+	vb := math.Pow(vh, 0.4996667741545416)
+	a0 := 1 + k / shelfQ + k * k
+	shelf := &filter.Biquad{
+		B0: (vh + vb * k / shelfQ + k * k) / a0,
+		B1: 2 * (k * k - vh) / a0,
+		B2: (vh - vb * k / shelfQ + k * k) / a0,
+		A1: 2 * (k * k - 1) / a0,
+		A2: (1 - k / shelfQ + k * k) / a0,
+	}
+
+	k = math.Tan(math.Pi * highPassFrequency / sampleRate)
+	a0 = 1 + k / highPassQ + k * k
+	highPass := &filter.Biquad{
+		B0: 1,
+		B1: -2,
+		B2: 1,
+		A1: 2 * (k * k - 1) / a0,
+		A2: (1 - k / highPassQ + k * k) / a0,
+	}
+
+	return shelf, highPass
+}
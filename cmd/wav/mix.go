@@ -0,0 +1,211 @@
+package wav
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+// softClipKnee is the level above which SoftClip starts to compress peaks
+const softClipKnee = 0.7
+
+// Track is a wav file placed within a mix
+type Track struct {
+	// Wav is the audio of the track. It isn't changed by mixing.
+	Wav *Wav
+
+	// Offset is how far into the mix the track starts
+	Offset time.Duration
+
+	// GainDB is the gain applied to the track, in decibels. Zero leaves its
+	// level unchanged.
+	GainDB float64
+
+	// Pan places the track between the left (-1) and right (1) channels of a
+	// stereo mix. Panning away from the centre (0) turns down the opposite
+	// channel, so a stereo track keeps both of its channels.
+	Pan float64
+}
+
+// ClipHandling is how a mix deals with peaks that add up to more than full
+// scale
+type ClipHandling int
+
+const (
+	// PreventClipping turns the whole mix down, if needed, so that its
+	// loudest peak is at full scale
+	PreventClipping ClipHandling = iota
+
+	// SoftClip leaves the level of the mix alone, and smoothly squashes peaks
+	// above -3 dBFS so that they never go past full scale. This adds some
+	// distortion to the loudest peaks.
+	SoftClip
+
+	// HardClip leaves the mix as it is, and lets integer formats clamp any
+	// samples that go past full scale
+	HardClip
+)
+
+// MixOptions configures how tracks are mixed together
+type MixOptions struct {
+	// Clipping is how peaks that add up to more than full scale are dealt
+	// with
+	Clipping ClipHandling
+}
+
+// Mix lays the given tracks over each other, returning the result as a new wav
+// file. See MixWithOptions for how the tracks are combined; Mix prevents
+// clipping by turning the mix down if it needs to.
+func Mix(tracks ...Track) (*Wav, error) {
+	return MixWithOptions(MixOptions{}, tracks...)
+}
+
+// MixWithOptions lays the given tracks over each other, returning the result as
+// a new wav file. Tracks with different sample rates are resampled to the
+// highest rate. The mix is stereo if any track is stereo or panned, and mono
+// tracks are copied to both channels. As with Concat, the mix uses the largest
+// bit depth of the tracks, and is IEEE float if any of them are.
+func MixWithOptions(opts MixOptions, tracks ...Track) (*Wav, error) {
+	if len(tracks) == 0 {
+		return nil, errors.New("at least 1 track is needed to make a mix")
+	}
+	if opts.Clipping < PreventClipping || opts.Clipping > HardClip {
+		return nil, errors.New("unknown clip handling")
+	}
+
+	mix := &Wav{FormatType: PCMFormat}
+	for i, track := range tracks {
+		if track.Wav == nil {
+			return nil, fmt.Errorf("track %v has no audio", i + 1)
+		}
+		if track.Offset < 0 {
+			return nil, fmt.Errorf("track %v has a negative offset", i + 1)
+		}
+		if track.Pan < -1 || track.Pan > 1 {
+			return nil, fmt.Errorf("track %v has pan %v, which isn't between -1 and 1", i + 1, track.Pan)
+		}
+
+		// Mono and stereo tracks can be mixed together, any other number of
+		// channels can only be mixed with tracks that have the same number
+		channels := track.Wav.Channels
+		if channels == 0 {
+			return nil, fmt.Errorf("track %v has no channels", i + 1)
+		}
+		if channels == 1 && track.Pan != 0 {
+			channels = 2
+		}
+		if i == 0 || (channels <= 2 && mix.Channels <= 2 && channels > mix.Channels) {
+			mix.Channels = channels
+		} else if (channels > 2 || mix.Channels > 2) && channels != mix.Channels {
+			return nil, fmt.Errorf("cannot mix wavs with %v and %v channels", mix.Channels, channels)
+		}
+
+		if i == 0 {
+			mix.SampleRate = track.Wav.SampleRate
+			mix.setSampleFormat(track.Wav.Format().sampleFormat(), track.Wav.BitsPerSample)
+		} else {
+			mix.setCombinedFormat(track.Wav)
+		}
+		if track.Wav.SampleRate > mix.SampleRate {
+			mix.SampleRate = track.Wav.SampleRate
+		}
+	}
+	if mix.SampleRate == 0 {
+		return nil, errors.New("sample rate must be greater than 0")
+	}
+
+	// Bring every track to the mix's sample rate, and work out how long the
+	// mix needs to be to fit them all
+	trackSamples := make([]Buffer[float64], len(tracks))
+	offsets := make([]int, len(tracks))
+	frames := 0
+	for i, track := range tracks {
+		samples, err := track.Wav.Float64Samples()
+		if err != nil {
+			return nil, err
+		}
+
+		if track.Wav.SampleRate != mix.SampleRate {
+			step := float64(track.Wav.SampleRate) / float64(mix.SampleRate)
+			resampledFrames := int(math.Ceil(float64(samples.Frames()) / step))
+			samples = resampleBuffer(samples, step, resampledFrames, DefaultQuality)
+		}
+
+		trackSamples[i] = samples
+		offsets[i] = mix.frameAt(track.Offset)
+		if end := offsets[i] + samples.Frames(); end > frames {
+			frames = end
+		}
+	}
+
+	blockSize := float64(mix.Channels) * float64(mix.BitsPerSample / 8)
+	if float64(frames) * blockSize > math.MaxUint32 {
+		return nil, errors.New("resulting data size would be too large (> max uint32)")
+	}
+
+	mixed := NewBuffer[float64](int(mix.Channels), frames)
+	for i, track := range tracks {
+		samples := trackSamples[i]
+		gain := math.Pow(10, track.GainDB / 20)
+
+		for c := range mixed {
+			source := samples[c % samples.Channels()]
+			channelGain := gain * panGain(track.Pan, c, mixed.Channels())
+			for j, v := range source {
+				mixed[c][offsets[i] + j] += v * channelGain
+			}
+		}
+	}
+
+	switch opts.Clipping {
+	case PreventClipping:
+		if peak := samplePeak(mixed); peak > 1 {
+			for c := range mixed {
+				for j := range mixed[c] {
+					mixed[c][j] /= peak
+				}
+			}
+		}
+	case SoftClip:
+		for c := range mixed {
+			for j, v := range mixed[c] {
+				mixed[c][j] = softClip(v)
+			}
+		}
+	}
+
+	if err := mix.SetFromFloat64(mixed); err != nil {
+		return nil, err
+	}
+
+	return mix, nil
+}
+
+// panGain returns the gain of `channel` for a track panned to `pan`. Only
+// stereo mixes are panned. The channel on the side being panned to is left at
+// full level, and the other is turned down along a quarter cosine.
+func panGain(pan float64, channel, channels int) float64 {
+	if channels != 2 {
+		return 1
+	}
+
+	if (channel == 0 && pan > 0) || (channel == 1 && pan < 0) {
+		return math.Cos(math.Abs(pan) * math.Pi / 2)
+	}
+
+	return 1
+}
+
+// softClip passes samples below softClipKnee through unchanged, and
+// smoothly squashes louder samples so that they approach, but never pass, full
+// scale
+func softClip(v float64) float64 {
+	magnitude := math.Abs(v)
+	if magnitude <= softClipKnee {
+		return v
+	}
+
+	headroom := 1 - softClipKnee
+	return math.Copysign(softClipKnee + headroom * math.Tanh((magnitude - softClipKnee) / headroom), v)
+}
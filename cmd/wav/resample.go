@@ -0,0 +1,311 @@
+package wav
+
+import (
+	"errors"
+	"math"
+)
+
+// ResampleMethod is an algorithm used to convert audio between sample rates
+type ResampleMethod int
+
+const (
+	// LinearInterpolation draws a straight line between neighbouring samples.
+	// It's very fast, but doesn't filter the audio, so frequencies above the
+	// new Nyquist frequency alias when downsampling.
+	LinearInterpolation ResampleMethod = iota
+
+	// WindowedSinc filters the audio with a Kaiser windowed sinc function,
+	// computed exactly for every output sample. It's the most accurate method,
+	// and the slowest.
+	WindowedSinc
+
+	// Polyphase uses the same filter as WindowedSinc, but precomputes it at a
+	// fixed set of offsets (phases) and interpolates between them. It's nearly
+	// as accurate and many times faster. When downsampling by a very large
+	// ratio, where the table of phases would take too much memory, it falls
+	// back to WindowedSinc.
+	Polyphase
+)
+
+const (
+	// defaultResampleTaps is the number of filter taps used when none are
+	// given
+	defaultResampleTaps = 64
+
+	// defaultKaiserBeta is the Kaiser window shape used when none is given,
+	// attenuating the stopband by roughly 86 dB
+	defaultKaiserBeta = 8.6
+
+	// resampleCutoff is the cutoff of the low pass filter, as a fraction of
+	// the lower of the two Nyquist frequencies. It's a little below 1 so that
+	// the filter's transition band is over by the time it reaches Nyquist.
+	resampleCutoff = 0.9
+
+	// polyphaseResolution is the number of filter phases precomputed per
+	// sample by the Polyphase method
+	polyphaseResolution = 512
+
+	// maxPolyphaseTable is the most filter values the Polyphase method will
+	// precompute (32 MB worth). Downsampling by a large ratio widens the
+	// filter enough to need more, in which case the filter is computed
+	// directly for each sample instead, as WindowedSinc does.
+	maxPolyphaseTable = 1 << 22
+)
+
+// Quality configures how audio is resampled
+type Quality struct {
+	// Method is the algorithm used to resample the audio
+	Method ResampleMethod
+
+	// Taps is the length of the filter used by WindowedSinc and Polyphase,
+	// in samples at the lower of the two sample rates. More taps give a
+	// sharper cutoff but take longer. Zero uses 64 taps.
+	Taps int
+
+	// KaiserBeta shapes the Kaiser window applied to the filter. Higher
+	// values attenuate more above the cutoff, at the cost of a wider
+	// transition band. Zero uses 8.6.
+	KaiserBeta float64
+}
+
+// DefaultQuality is the quality used by Resample
+var DefaultQuality = Quality{Method: Polyphase, Taps: defaultResampleTaps, KaiserBeta: defaultKaiserBeta}
+
+// Resample will update the sample rate of the wave file, without
+// changing the duration or pitch.
+func (w *Wav) Resample(newSampleRate uint32) error {
+	return w.ResampleWithOptions(newSampleRate, DefaultQuality)
+}
+
+// ResampleWithOptions will update the sample rate of the wave file, without
+// changing the duration or pitch, using the given resampling quality. Samples
+// that end up beyond full scale are clamped.
+func (w *Wav) ResampleWithOptions(newSampleRate uint32, quality Quality) error {
+	if newSampleRate == 0 {
+		return errors.New("sample rate must be greater than 0")
+	}
+	quality, err := quality.withDefaults()
+	if err != nil {
+		return err
+	}
+	if newSampleRate == w.SampleRate {
+		return nil
+	}
+
+	step := float64(w.SampleRate) / float64(newSampleRate)
+	frames := math.Ceil(float64(len(w.Data)) / step)
+	if frames * float64(w.DataBlockSize) > math.MaxUint32 {
+		return errors.New("resulting data size would be too large (> max uint32)")
+	}
+
+	samples, err := w.Float64Samples()
+	if err != nil {
+		return err
+	}
+
+	w.SampleRate = newSampleRate
+	return w.SetFromFloat64(resampleBuffer(samples, step, int(frames), quality))
+}
+
+// withDefaults checks the quality's settings, filling in defaults for any that
+// are zero
+func (q Quality) withDefaults() (Quality, error) {
+	if q.Method != LinearInterpolation && q.Method != WindowedSinc && q.Method != Polyphase {
+		return q, errors.New("unknown resample method")
+	}
+	if q.Taps < 0 {
+		return q, errors.New("number of taps can't be negative")
+	}
+	if q.KaiserBeta < 0 {
+		return q, errors.New("kaiser beta can't be negative")
+	}
+
+	if q.Taps == 0 {
+		q.Taps = defaultResampleTaps
+	}
+	if q.KaiserBeta == 0 {
+		q.KaiserBeta = defaultKaiserBeta
+	}
+
+	return q, nil
+}
+
+// resampleBuffer reads `frames` frames from `samples`, stepping through them
+// `step` frames at a time. A step above 1 lowers the sample rate, and a step
+// below 1 raises it.
+func resampleBuffer(samples Buffer[float64], step float64, frames int, quality Quality) Buffer[float64] {
+	if quality.Method == LinearInterpolation {
+		return resampleLinear(samples, step, frames)
+	}
+
+	filter := newSincFilter(step, quality)
+	if quality.Method == Polyphase && (polyphaseResolution + 1) * (2 * filter.halfWidth + 2) <= maxPolyphaseTable {
+		return filter.resamplePolyphase(samples, step, frames)
+	}
+
+	resampled := NewBuffer[float64](samples.Channels(), frames)
+	weights := make([]float64, 2 * filter.halfWidth + 2)
+	for i := 0; i < frames; i++ {
+		position := float64(i) * step
+		first := int(math.Floor(position)) - filter.halfWidth
+
+		total := 0.0
+		for n := range weights {
+			weights[n] = filter.at(position - float64(first + n))
+			total += weights[n]
+		}
+
+		for c := range samples {
+			sum := 0.0
+			for n, weight := range weights {
+				sum += sampleAt(samples[c], first + n) * weight
+			}
+			resampled[c][i] = sum / total
+		}
+	}
+
+	return resampled
+}
+
+// resampleLinear reads `frames` frames from `samples`, stepping through them
+// `step` frames at a time and interpolating linearly between neighbouring
+// samples
+func resampleLinear(samples Buffer[float64], step float64, frames int) Buffer[float64] {
+	resampled := NewBuffer[float64](samples.Channels(), frames)
+	for c := range samples {
+		for i := range resampled[c] {
+			position := float64(i) * step
+			j := int(position)
+			fraction := position - float64(j)
+			resampled[c][i] = sampleAt(samples[c], j) * (1 - fraction) + sampleAt(samples[c], j + 1) * fraction
+		}
+	}
+
+	return resampled
+}
+
+// sincFilter is a Kaiser windowed sinc low pass filter, measured in samples
+// of the input
+type sincFilter struct {
+	// cutoff is the cutoff frequency, in cycles per input sample
+	cutoff float64
+
+	// width is how far the filter extends either side of its centre, and
+	// halfWidth is the same rounded up to whole samples
+	width float64
+	halfWidth int
+
+	beta float64
+	kaiserScale float64
+}
+
+// newSincFilter creates the filter used to resample audio by the given step.
+// When downsampling, the cutoff is lowered to the new Nyquist frequency and the
+// filter is widened to match, so that it still spans `quality.Taps` samples at
+// the new rate.
+func newSincFilter(step float64, quality Quality) sincFilter {
+	scale := math.Max(step, 1)
+	width := float64(quality.Taps) / 2 * scale
+
+	return sincFilter{
+		cutoff: resampleCutoff * 0.5 / scale,
+		width: width,
+		halfWidth: int(math.Ceil(width)),
+		beta: quality.KaiserBeta,
+		kaiserScale: 1 / besselI0(quality.KaiserBeta),
+	}
+}
+
+// at returns the value of the filter `t` input samples from its centre
+func (f sincFilter) at(t float64) float64 {
+	if math.Abs(t) >= f.width {
+		return 0
+	}
+
+	x := 2 * f.cutoff * t
+	sinc := 1.0
+	if x != 0 {
+		sinc = math.Sin(math.Pi * x) / (math.Pi * x)
+	}
+
+	ratio := t / f.width
+	window := besselI0(f.beta * math.Sqrt(1 - ratio * ratio)) * f.kaiserScale
+
+	return 2 * f.cutoff * sinc * window
+}
+
+// resamplePolyphase resamples using a table of the filter's values at
+// polyphaseResolution offsets between each pair of input samples, interpolating
+// between the two nearest offsets
+func (f sincFilter) resamplePolyphase(samples Buffer[float64], step float64, frames int) Buffer[float64] {
+	taps := 2 * f.halfWidth + 2
+	phases := make([][]float64, polyphaseResolution + 1)
+	for p := range phases {
+		phases[p] = make([]float64, taps)
+		offset := float64(p) / polyphaseResolution
+
+		// Normalize each phase, so that the gain doesn't ripple between
+		// them
+		total := 0.0
+		for n := range phases[p] {
+			phases[p][n] = f.at(offset + float64(f.halfWidth - n))
+			total += phases[p][n]
+		}
+		for n := range phases[p] {
+			phases[p][n] /= total
+		}
+	}
+
+	resampled := NewBuffer[float64](samples.Channels(), frames)
+	interpolated := make([]float64, taps)
+	for i := 0; i < frames; i++ {
+		position := float64(i) * step
+		whole := math.Floor(position)
+		phase := (position - whole) * polyphaseResolution
+		p := int(phase)
+		fraction := phase - float64(p)
+		first := int(whole) - f.halfWidth
+
+		// Positions that land exactly on a phase (as they do when changing
+		// the rate by a whole number) don't need interpolating
+		weights := phases[p]
+		if fraction != 0 {
+			for n := range interpolated {
+				interpolated[n] = phases[p][n] + (phases[p + 1][n] - phases[p][n]) * fraction
+			}
+			weights = interpolated
+		}
+
+		for c := range samples {
+			sum := 0.0
+			if first >= 0 && first + taps <= len(samples[c]) {
+				for n, v := range samples[c][first : first + taps] {
+					sum += v * weights[n]
+				}
+			} else {
+				for n, weight := range weights {
+					sum += sampleAt(samples[c], first + n) * weight
+				}
+			}
+			resampled[c][i] = sum
+		}
+	}
+
+	return resampled
+}
+
+// besselI0 computes the zeroth order modified Bessel function of the first
+// kind, which defines the Kaiser window
+func besselI0(x float64) float64 {
+	sum := 1.0
+	term := 1.0
+	for k := 1; k < 50; k++ {
+		term *= (x / (2 * float64(k))) * (x / (2 * float64(k)))
+		sum += term
+		if term < sum * 1e-12 {
+			break
+		}
+	}
+
+	return sum
+}
@@ -0,0 +1,212 @@
+package wav
+
+import (
+	"math"
+	"time"
+
+	"github.com/liamcr/wavy/internal/util"
+)
+
+const (
+	// DefaultSilenceThreshold is the level, in dBFS, below which audio is
+	// treated as silence when no other threshold is given
+	DefaultSilenceThreshold = -50.0
+
+	// DefaultMinSilence is the shortest stretch of silence that SplitOnSilence
+	// splits audio at when no other duration is given
+	DefaultMinSilence = 500 * time.Millisecond
+
+	// levelBucket is the length of the buckets that the level of audio is
+	// measured over when looking for silence
+	levelBucket = 10 * time.Millisecond
+)
+
+// Interval is a span of time within a wav file, from Start up to End
+type Interval struct {
+	Start time.Duration
+	End time.Duration
+}
+
+// SilenceOptions configures how SplitOnSilence finds the gaps to split audio at
+type SilenceOptions struct {
+	// ThresholdDB is the level, in dBFS, below which audio counts as silent.
+	// Zero uses DefaultSilenceThreshold.
+	ThresholdDB float64
+
+	// MinDuration is the shortest stretch of silence that the audio is split
+	// at. Zero uses DefaultMinSilence.
+	MinDuration time.Duration
+
+	// Padding is the amount of silence kept either side of each piece, so
+	// that the pieces don't start or end abruptly
+	Padding time.Duration
+}
+
+// span is a range of sample groups, from start up to (but not including) end
+type span struct {
+	start int
+	end int
+}
+
+// DetectSilence finds the parts of the wav file that stay below
+// `thresholdDB` dBFS for at least `minDuration`. The level of the audio is
+// measured as the RMS of each channel over 10ms buckets, and a bucket only
+// counts as silent if every channel is below the threshold. No silence is
+// found in wavs whose samples can't be read.
+func (w *Wav) DetectSilence(thresholdDB float64, minDuration time.Duration) []Interval {
+	silences, err := w.silentSpans(thresholdDB, minDuration)
+	if err != nil {
+		return nil
+	}
+
+	intervals := make([]Interval, len(silences))
+	for i, silence := range silences {
+		intervals[i] = Interval{Start: w.durationAt(silence.start), End: w.durationAt(silence.end)}
+	}
+
+	return intervals
+}
+
+// SplitOnSilence cuts the wav file into pieces at each stretch of silence, as
+// found by DetectSilence, and returns the pieces as new wav files. Silence at
+// the start and end of the wav is dropped. The original wav is left unchanged.
+func (w *Wav) SplitOnSilence(opts SilenceOptions) ([]*Wav, error) {
+	if opts.ThresholdDB == 0 {
+		opts.ThresholdDB = DefaultSilenceThreshold
+	}
+	if opts.MinDuration == 0 {
+		opts.MinDuration = DefaultMinSilence
+	}
+
+	silences, err := w.silentSpans(opts.ThresholdDB, opts.MinDuration)
+	if err != nil {
+		return nil, err
+	}
+
+	// The pieces are the gaps between the silences. Padding can reach at most
+	// halfway into the silences between pieces, so that pieces don't overlap
+	padding := w.frameAt(opts.Padding)
+	pieces := []*Wav{}
+	for i := 0; i <= len(silences); i++ {
+		start, lower := 0, 0
+		if i > 0 {
+			previous := silences[i - 1]
+			start, lower = previous.end, previous.start
+			if previous.start > 0 {
+				lower = (previous.start + previous.end) / 2
+			}
+		}
+
+		end, upper := len(w.Data), len(w.Data)
+		if i < len(silences) {
+			next := silences[i]
+			end, upper = next.start, next.end
+			if next.end < len(w.Data) {
+				upper = (next.start + next.end) / 2
+			}
+		}
+
+		if end <= start {
+			continue
+		}
+
+		piece, err := w.Slice(util.MaxInt(start - padding, lower), util.MinInt(end + padding, upper))
+		if err != nil {
+			return nil, err
+		}
+		pieces = append(pieces, piece)
+	}
+
+	return pieces, nil
+}
+
+// TrimSilence removes the silence from the start (`leading`) and/or the end
+// (`trailing`) of the wav file. Audio below DefaultSilenceThreshold counts as
+// silent.
+func (w *Wav) TrimSilence(leading, trailing bool) error {
+	silences, err := w.silentSpans(DefaultSilenceThreshold, 0)
+	if err != nil {
+		return err
+	}
+	if len(silences) == 0 {
+		return nil
+	}
+
+	start, end := 0, len(w.Data)
+	if first := silences[0]; leading && first.start == 0 {
+		start = first.end
+	}
+	if last := silences[len(silences) - 1]; trailing && last.end == len(w.Data) {
+		end = last.start
+	}
+	if start > end {
+		// The wav is entirely silent
+		end = start
+	}
+
+	w.Data = append([]SampleGroup{}, w.Data[start:end]...)
+	w.updateSizes()
+
+	return nil
+}
+
+// silentSpans finds the runs of buckets quieter than `thresholdDB` that last
+// at least `minDuration`
+func (w *Wav) silentSpans(thresholdDB float64, minDuration time.Duration) ([]span, error) {
+	samples, err := w.Float64Samples()
+	if err != nil {
+		return nil, err
+	}
+
+	bucketFrames := util.MaxInt(w.frameAt(levelBucket), 1)
+	levels := bucketLevels(samples, bucketFrames)
+	minFrames := w.frameAt(minDuration)
+
+	silences := []span{}
+	runStart := -1
+	for i := 0; i <= len(levels); i++ {
+		silent := i < len(levels) && levels[i] < thresholdDB
+		if silent && runStart < 0 {
+			runStart = i
+		} else if !silent && runStart >= 0 {
+			silence := span{start: runStart * bucketFrames, end: util.MinInt(i * bucketFrames, samples.Frames())}
+			if silence.end - silence.start >= minFrames {
+				silences = append(silences, silence)
+			}
+			runStart = -1
+		}
+	}
+
+	return silences, nil
+}
+
+// bucketLevels separates `samples` into buckets of `bucketFrames` frames
+// (the last of which may be shorter), and returns the level of each in dBFS.
+// The level of a bucket is the RMS of its loudest channel.
+func bucketLevels(samples Buffer[float64], bucketFrames int) []float64 {
+	frames := samples.Frames()
+	levels := make([]float64, (frames + bucketFrames - 1) / bucketFrames)
+	for i := range levels {
+		start := i * bucketFrames
+		end := util.MinInt(start + bucketFrames, frames)
+
+		loudest := 0.0
+		for c := range samples {
+			sum := 0.0
+			for _, v := range samples[c][start:end] {
+				sum += v * v
+			}
+			loudest = math.Max(loudest, sum / float64(end - start))
+		}
+
+		levels[i] = 10 * math.Log10(loudest)
+	}
+
+	return levels
+}
+
+// durationAt converts the index of a sample group into the time offset at
+// which it plays
+func (w *Wav) durationAt(frame int) time.Duration {
+	return time.Duration(math.Round(float64(frame) / float64(w.SampleRate) * float64(time.Second)))
+}
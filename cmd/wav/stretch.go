@@ -0,0 +1,417 @@
+package wav
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/cmplx"
+	"time"
+
+	"github.com/liamcr/wavy/internal/util"
+)
+
+// StretchMethod is an algorithm used by TimeStretch to change the duration of
+// audio without changing its pitch
+type StretchMethod int
+
+const (
+	// WSOLA (waveform similarity overlap-add) rebuilds the audio from short
+	// overlapping windows of the original, nudging each window so that it
+	// lines up with the waveform of the previous one. It keeps transients
+	// sharp and suits speech.
+	WSOLA StretchMethod = iota
+
+	// PhaseVocoder stretches the audio in the frequency domain, advancing the
+	// phase of each frequency at its own rate. It avoids the warble WSOLA can
+	// give polyphonic material, and suits music.
+	PhaseVocoder
+)
+
+const (
+	// defaultWSOLAWindow is the window size used by WSOLA when none is given.
+	// It's a little longer than the pitch period of most voices.
+	defaultWSOLAWindow = 30 * time.Millisecond
+
+	// defaultPhaseVocoderWindow is the window size used by the phase vocoder
+	// when none is given, roughly 2048 samples at 44.1 kHz
+	defaultPhaseVocoderWindow = 46 * time.Millisecond
+
+	// minStretchWindow is the smallest window, in samples, that either method
+	// will use
+	minStretchWindow = 16
+
+	// maxPitchShiftCents is the largest pitch shift, up or down, that
+	// PitchShiftCents allows
+	maxPitchShiftCents = 4800
+)
+
+// TimeStretchOptions configures how TimeStretch changes the duration of audio
+type TimeStretchOptions struct {
+	// Method is the algorithm used to stretch the audio
+	Method StretchMethod
+
+	// WindowSize is the length of the windows the audio is processed in.
+	// Longer windows give better frequency resolution, shorter windows
+	// smear transients less. Zero picks a default suited to the method.
+	WindowSize time.Duration
+}
+
+// TimeStretch speeds up the wav file by a specified factor without changing its
+// pitch. As with SpeedUp, a factor of 2 makes the wav twice as fast (half as
+// long), and a factor of 0.5 makes it twice as slow. The sample rate and format
+// are left as they are.
+func (w *Wav) TimeStretch(factor float64, opts TimeStretchOptions) error {
+	if !(factor > 0) || math.IsInf(factor, 1) {
+		return errors.New("factor must be greater than 0")
+	}
+	if opts.Method != WSOLA && opts.Method != PhaseVocoder {
+		return errors.New("unknown time stretch method")
+	}
+
+	newFrames := math.Round(float64(len(w.Data)) / factor)
+	if newFrames * float64(w.DataBlockSize) > math.MaxUint32 {
+		return errors.New("resulting data size would be too large (> max uint32)")
+	}
+
+	samples, err := w.Float64Samples()
+	if err != nil {
+		return err
+	}
+
+	windowFrames := stretchWindow(opts, w.SampleRate)
+
+	var stretched Buffer[float64]
+	if opts.Method == PhaseVocoder {
+		stretched = stretchPhaseVocoder(samples, factor, int(newFrames), windowFrames)
+	} else {
+		stretched = stretchWSOLA(samples, factor, int(newFrames), windowFrames)
+	}
+
+	return w.SetFromFloat64(stretched)
+}
+
+// PitchShift changes the pitch of the wav file by a number of semitones,
+// without changing its duration. Positive values raise the pitch, negative
+// values lower it, and 12 semitones make an octave.
+func (w *Wav) PitchShift(semitones float64) error {
+	return w.PitchShiftCents(semitones * 100)
+}
+
+// PitchShiftCents changes the pitch of the wav file by a number of cents
+// (hundredths of a semitone), without changing its duration. Shifts are
+// limited to 4 octaves (4800 cents) either way.
+func (w *Wav) PitchShiftCents(cents float64) error {
+	if math.IsNaN(cents) || math.Abs(cents) > maxPitchShiftCents {
+		return fmt.Errorf("pitch shift must be between -%v and %v cents", maxPitchShiftCents, maxPitchShiftCents)
+	}
+
+	samples, err := w.Float64Samples()
+	if err != nil {
+		return err
+	}
+
+	// Stretch the audio so that it's longer by the pitch ratio, then squeeze
+	// it back to its original length, which raises the pitch by the same
+	// ratio. The phase vocoder keeps the channels' phases locked together,
+	// so stereo audio doesn't drift apart.
+	ratio := math.Pow(2, cents / 1200)
+	frames := samples.Frames()
+	windowFrames := stretchWindow(TimeStretchOptions{Method: PhaseVocoder}, w.SampleRate)
+	stretched := stretchPhaseVocoder(samples, 1 / ratio, int(math.Round(float64(frames) * ratio)), windowFrames)
+
+	return w.SetFromFloat64(resampleBuffer(stretched, ratio, frames, DefaultQuality))
+}
+
+// stretchWindow returns the window size, in samples, to stretch audio at the
+// given sample rate with. Phase vocoder windows are rounded up to a power of
+// two.
+func stretchWindow(opts TimeStretchOptions, sampleRate uint32) int {
+	windowSize := opts.WindowSize
+	if windowSize <= 0 {
+		windowSize = defaultWSOLAWindow
+		if opts.Method == PhaseVocoder {
+			windowSize = defaultPhaseVocoderWindow
+		}
+	}
+
+	windowFrames := int(windowSize.Seconds() * float64(sampleRate))
+	if windowFrames < minStretchWindow {
+		windowFrames = minStretchWindow
+	}
+	if opts.Method == PhaseVocoder {
+		windowFrames = util.NextPowerOfTwo(windowFrames)
+	}
+
+	return windowFrames
+}
+
+// stretchWSOLA stretches `samples` to `frames` frames using WSOLA. Window
+// positions are chosen from a mono mix of the channels, and then used for
+// every channel, so that the channels stay aligned with each other.
+func stretchWSOLA(samples Buffer[float64], factor float64, frames, windowSize int) Buffer[float64] {
+	stretched := NewBuffer[float64](samples.Channels(), frames)
+	weights := make([]float64, frames)
+
+	// Hann windows overlapping by half sum to a constant, so windows are
+	// placed half a window apart in the output
+	window := hannWindow(windowSize)
+	synthesisHop := windowSize / 2
+	analysisHop := float64(synthesisHop) * factor
+	tolerance := synthesisHop / 2
+	mono := samples.MixToMono()[0]
+
+	previous := 0
+	for k := 0; k * synthesisHop - windowSize / 2 < frames; k++ {
+		outputStart := k * synthesisHop - windowSize / 2
+		inputStart := int(math.Round(float64(k) * analysisHop)) - windowSize / 2
+
+		if k > 0 {
+			// The audio that followed the previous window in the input is the
+			// most natural continuation of the output so far, so use the
+			// window near the nominal position that best resembles it
+			inputStart = bestOverlap(mono, previous + synthesisHop, inputStart, tolerance, windowSize)
+		}
+		previous = inputStart
+
+		for i := 0; i < windowSize; i++ {
+			j := outputStart + i
+			if j < 0 || j >= frames {
+				continue
+			}
+
+			weights[j] += window[i]
+			for c := range samples {
+				stretched[c][j] += sampleAt(samples[c], inputStart + i) * window[i]
+			}
+		}
+	}
+
+	normalizeOverlapAdd(stretched, weights)
+	return stretched
+}
+
+// bestOverlap searches within `tolerance` samples of `nominal` for the window
+// of `signal` most similar to the window starting at `target`, and returns its
+// start. The search is done coarsely first, then refined around the best match.
+func bestOverlap(signal []float64, target, nominal, tolerance, windowSize int) int {
+	const coarseStep = 4
+
+	best := nominal
+	bestScore := math.Inf(-1)
+	search := func(from, to, step, stride int) {
+		for start := from; start <= to; start += step {
+			correlation := 0.0
+			energy := 0.0
+			for i := 0; i < windowSize; i += stride {
+				candidate := sampleAt(signal, start + i)
+				correlation += candidate * sampleAt(signal, target + i)
+				energy += candidate * candidate
+			}
+
+			// Normalize by the energy of the candidate so that louder
+			// windows aren't favoured just for being loud
+			score := correlation / math.Sqrt(energy + 1e-12)
+			if score > bestScore {
+				best = start
+				bestScore = score
+			}
+		}
+	}
+
+	search(nominal - tolerance, nominal + tolerance, coarseStep, coarseStep)
+	coarseBest := best
+	bestScore = math.Inf(-1)
+	search(coarseBest - coarseStep + 1, coarseBest + coarseStep - 1, 1, 1)
+
+	return best
+}
+
+// stretchPhaseVocoder stretches `samples` to `frames` frames using a phase
+// vocoder with windows of `windowSize` samples, which must be a power of two.
+//
+// Every channel is rotated by the same phase in each bin, so the channels
+// keep their phases relative to each other. Advancing each channel
+// independently would let small estimation errors build up differently per
+// channel, smearing the stereo image over time. The rotation is worked out
+// from whichever channel is loudest in that bin, so that channels cancelling
+// each other out (e.g. when they're out of phase) doesn't matter.
+func stretchPhaseVocoder(samples Buffer[float64], factor float64, frames, windowSize int) Buffer[float64] {
+	stretched := NewBuffer[float64](samples.Channels(), frames)
+	weights := make([]float64, frames)
+
+	window := hannWindow(windowSize)
+	synthesisHop := windowSize / 4
+	bins := windowSize / 2 + 1
+
+	spectra := make([][]complex128, samples.Channels())
+	for c := range spectra {
+		spectra[c] = make([]complex128, windowSize)
+	}
+
+	// The phase of every channel in each bin, as analysed and after rotation,
+	// and the same from the previous window
+	phases := NewBuffer[float64](samples.Channels(), bins)
+	previousPhases := NewBuffer[float64](samples.Channels(), bins)
+	synthesisPhases := NewBuffer[float64](samples.Channels(), bins)
+
+	magnitudes := make([]float64, bins)
+	loudest := make([]int, bins)
+	rotations := make([]float64, bins)
+	var peaks []int
+
+	previousCentre := 0
+	for k := 0; k * synthesisHop - windowSize / 2 < frames; k++ {
+		outputStart := k * synthesisHop - windowSize / 2
+		inputCentre := int(math.Round(float64(k * synthesisHop) * factor))
+		analysisHop := float64(inputCentre - previousCentre)
+		previousCentre = inputCentre
+
+		for c := range samples {
+			for i := range spectra[c] {
+				spectra[c][i] = complex(sampleAt(samples[c], inputCentre - windowSize / 2 + i) * window[i], 0)
+			}
+			util.FFT(spectra[c])
+		}
+
+		for b := 0; b < bins; b++ {
+			magnitudes[b] = 0
+			loudestMagnitude := -1.0
+			for c := range spectra {
+				magnitude := cmplx.Abs(spectra[c][b])
+				magnitudes[b] += magnitude
+				phases[c][b] = cmplx.Phase(spectra[c][b])
+				if magnitude > loudestMagnitude {
+					loudestMagnitude = magnitude
+					loudest[b] = c
+				}
+			}
+		}
+
+		peaks = spectralPeaks(peaks[:0], magnitudes)
+		for _, b := range peaks {
+			rotations[b] = 0
+			if k == 0 {
+				continue
+			}
+
+			// Estimate the true frequency of the peak from how far its phase
+			// moved beyond what the bin's centre frequency predicts
+			c := loudest[b]
+			binFrequency := 2 * math.Pi * float64(b) / float64(windowSize)
+			frequency := binFrequency
+			if analysisHop > 0 {
+				deviation := wrapPhase(phases[c][b] - previousPhases[c][b] - binFrequency * analysisHop)
+				frequency += deviation / analysisHop
+			}
+			newPhase := synthesisPhases[c][b] + frequency * float64(synthesisHop)
+			rotations[b] = wrapPhase(newPhase - phases[c][b])
+		}
+
+		// Bins around each peak belong to the same partial, so they're
+		// rotated along with the peak rather than being advanced on their
+		// own, which would make them drift apart and sound phasey
+		peak := 0
+		for b := 0; b < bins; b++ {
+			if len(peaks) == 0 {
+				rotations[b] = 0
+				continue
+			}
+			for peak + 1 < len(peaks) && peaks[peak + 1] - b < b - peaks[peak] {
+				peak++
+			}
+			rotations[b] = rotations[peaks[peak]]
+		}
+
+		for b := 0; b < bins; b++ {
+			rotation := cmplx.Rect(1, rotations[b])
+			for c := range spectra {
+				spectra[c][b] *= rotation
+				previousPhases[c][b] = phases[c][b]
+				synthesisPhases[c][b] = wrapPhase(phases[c][b] + rotations[b])
+			}
+		}
+
+		for c := range spectra {
+			// Mirror the positive frequencies so the output is real
+			for b := 1; b < windowSize - bins + 1; b++ {
+				spectra[c][windowSize - b] = cmplx.Conj(spectra[c][b])
+			}
+			util.IFFT(spectra[c])
+		}
+
+		for i := 0; i < windowSize; i++ {
+			j := outputStart + i
+			if j < 0 || j >= frames {
+				continue
+			}
+
+			weights[j] += window[i] * window[i]
+			for c := range samples {
+				stretched[c][j] += real(spectra[c][i]) * window[i]
+			}
+		}
+	}
+
+	normalizeOverlapAdd(stretched, weights)
+	return stretched
+}
+
+// spectralPeaks appends the bins of `magnitudes` that are louder than the two
+// bins either side of them to `peaks`
+func spectralPeaks(peaks []int, magnitudes []float64) []int {
+	for b, magnitude := range magnitudes {
+		if magnitude == 0 {
+			continue
+		}
+
+		isPeak := true
+		for n := b - 2; n <= b + 2 && isPeak; n++ {
+			if n != b && n >= 0 && n < len(magnitudes) && magnitudes[n] > magnitude {
+				isPeak = false
+			}
+		}
+		if isPeak {
+			peaks = append(peaks, b)
+		}
+	}
+
+	return peaks
+}
+
+// normalizeOverlapAdd divides each frame of `samples` by the total window
+// weight that was added to it
+func normalizeOverlapAdd(samples Buffer[float64], weights []float64) {
+	for i, weight := range weights {
+		if weight < 1e-6 {
+			continue
+		}
+		for c := range samples {
+			samples[c][i] /= weight
+		}
+	}
+}
+
+// hannWindow returns a periodic Hann window of the given size
+func hannWindow(size int) []float64 {
+	window := make([]float64, size)
+	for i := range window {
+		window[i] = 0.5 - 0.5 * math.Cos(2 * math.Pi * float64(i) / float64(size))
+	}
+
+	return window
+}
+
+// wrapPhase wraps an angle into the range [-π, π]
+func wrapPhase(phase float64) float64 {
+	return phase - 2 * math.Pi * math.Round(phase / (2 * math.Pi))
+}
+
+// sampleAt returns the sample at index `i` of `samples`, treating anything
+// outside of the slice as silence
+func sampleAt(samples []float64, i int) float64 {
+	if i < 0 || i >= len(samples) {
+		return 0
+	}
+
+	return samples[i]
+}
@@ -0,0 +1,107 @@
+package wav
+
+import (
+	"math"
+	"testing"
+)
+
+// newAntiPhaseWav creates a stereo 16-bit wav holding a 440 Hz sine wave, with
+// the right channel the inverse of the left
+func newAntiPhaseWav(t *testing.T, frames int) *Wav {
+	t.Helper()
+
+	w := newTestWav(t, 2, frames)
+	samples, err := w.Float64Samples()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range samples[1] {
+		samples[1][i] = -samples[0][i]
+	}
+	if err := w.SetFromFloat64(samples); err != nil {
+		t.Fatal(err)
+	}
+
+	return w
+}
+
+// measureTone returns the frequency and RMS level of the tone in `samples`,
+// ignoring the first and last quarter so edge effects don't count
+func measureTone(samples []float64, sampleRate uint32) (frequency, rms float64) {
+	middle := samples[len(samples) / 4 : len(samples) * 3 / 4]
+
+	// Time the rising zero crossings, interpolating between samples to find
+	// where each one falls
+	first, last, crossings := 0.0, 0.0, 0
+	for i := 1; i < len(middle); i++ {
+		if middle[i - 1] >= 0 || middle[i] < 0 {
+			continue
+		}
+
+		position := float64(i - 1) + middle[i - 1] / (middle[i - 1] - middle[i])
+		if crossings == 0 {
+			first = position
+		}
+		last = position
+		crossings++
+	}
+	if crossings > 1 {
+		frequency = float64(crossings - 1) / (last - first) * float64(sampleRate)
+	}
+
+	for _, v := range middle {
+		rms += v * v
+	}
+	rms = math.Sqrt(rms / float64(len(middle)))
+
+	return frequency, rms
+}
+
+// checkAntiPhaseTone fails the test unless both channels of `w` hold a tone
+// at `frequency` with the level of a 0.5 amplitude sine, still inverted
+// relative to each other
+func checkAntiPhaseTone(t *testing.T, w *Wav, frequency float64) {
+	t.Helper()
+
+	samples, err := w.Float64Samples()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectedRMS := 0.5 / math.Sqrt2
+	for c := range samples {
+		gotFrequency, gotRMS := measureTone(samples[c], w.SampleRate)
+		if math.Abs(gotFrequency - frequency) > frequency * 0.01 {
+			t.Errorf("channel %v: frequency = %.1f Hz, want %.1f Hz", c, gotFrequency, frequency)
+		}
+		if math.Abs(gotRMS - expectedRMS) > expectedRMS * 0.05 {
+			t.Errorf("channel %v: RMS = %.3f, want %.3f", c, gotRMS, expectedRMS)
+		}
+	}
+
+	sum := make([]float64, samples.Frames())
+	for i := range sum {
+		sum[i] = samples[0][i] + samples[1][i]
+	}
+	if _, rms := measureTone(sum, w.SampleRate); rms > expectedRMS * 0.05 {
+		t.Errorf("channels are no longer inverted: RMS of their sum = %.3f", rms)
+	}
+}
+
+func TestTimeStretchPhaseVocoderAntiPhase(t *testing.T) {
+	w := newAntiPhaseWav(t, 44100)
+	if err := w.TimeStretch(0.75, TimeStretchOptions{Method: PhaseVocoder}); err != nil {
+		t.Fatal(err)
+	}
+
+	checkAntiPhaseTone(t, w, 440)
+}
+
+func TestPitchShiftAntiPhase(t *testing.T) {
+	w := newAntiPhaseWav(t, 44100)
+	if err := w.PitchShift(12); err != nil {
+		t.Fatal(err)
+	}
+
+	checkAntiPhaseTone(t, w, 880)
+}
@@ -2,54 +2,295 @@ package wav
 
 import (
 	"errors"
+	"fmt"
 	"math"
+	"time"
+
+	"github.com/liamcr/wavy/internal/util"
 )
 
 // SpeedUp speeds up the wav file by a specified factor.
 // This will not only increase the speed of the audio, but
 // will increase the pitch as well.
 func (w *Wav) SpeedUp(factor float64) error {
-	if w.SampleRate > math.MaxUint32 / uint32(math.Ceil(factor)) {
+	if factor <= 0 {
+		return errors.New("factor must be greater than 0")
+	}
+	if float64(w.SampleRate) * factor > math.MaxUint32 {
 		return errors.New("resulting sample rate would be too large (> max uint32)")
 	}
 	w.SampleRate = uint32(factor * float64(w.SampleRate))
+	w.DataRate = w.SampleRate * uint32(w.DataBlockSize)
 	return nil
 }
 
 // SlowDown slows up the wav file by a specified factor.
 // This will not only decrease the speed of the audio, but
 // will lower the pitch as well.
-func (w *Wav) SlowDown(factor float32) {
+func (w *Wav) SlowDown(factor float32) error {
+	if factor <= 0 {
+		return errors.New("factor must be greater than 0")
+	}
+	if float64(w.SampleRate) / float64(factor) > math.MaxUint32 {
+		return errors.New("resulting sample rate would be too large (> max uint32)")
+	}
 	w.SampleRate = uint32(float32(w.SampleRate) / factor)
+	w.DataRate = w.SampleRate * uint32(w.DataBlockSize)
+	return nil
+}
+
+// SpeedUpResampled speeds up the wav file by a specified factor, like
+// SpeedUp, but then resamples the audio back to its original sample rate.
+// The pitch still increases, but the file keeps a standard sample rate
+// rather than ending up with an unusual one like 176400 Hz.
+func (w *Wav) SpeedUpResampled(factor float64) error {
+	sampleRate := w.SampleRate
+	if err := w.SpeedUp(factor); err != nil {
+		return err
+	}
+
+	return w.Resample(sampleRate)
+}
+
+// SlowDownResampled slows down the wav file by a specified factor, like
+// SlowDown, but then resamples the audio back to its original sample rate.
+// The pitch still decreases, but the file keeps a standard sample rate
+// rather than ending up with an unusual one like 11025 Hz.
+func (w *Wav) SlowDownResampled(factor float32) error {
+	sampleRate := w.SampleRate
+	if err := w.SlowDown(factor); err != nil {
+		return err
+	}
+
+	return w.Resample(sampleRate)
+}
+
+// Reverse reverses the order of the samples in the wav file, so that
+// it plays backwards
+func (w *Wav) Reverse() {
+	reverseSampleGroups(w.Data)
+}
+
+// ReverseRange reverses the order of the samples between `start` and
+// `end`, leaving the audio either side of the range as it is
+func (w *Wav) ReverseRange(start, end time.Duration) error {
+	startFrame, endFrame, err := w.frameRange(start, end)
+	if err != nil {
+		return err
+	}
+
+	reverseSampleGroups(w.Data[startFrame:endFrame])
+	return nil
+}
+
+// reverseSampleGroups reverses the order of `data` in place
+func reverseSampleGroups(data []SampleGroup) {
+	for i, j := 0, len(data) - 1; i < j; i, j = i + 1, j - 1 {
+		data[i], data[j] = data[j], data[i]
+	}
+}
+
+// Trim cuts the wav file down to the audio between `start` and `end`,
+// discarding everything before and after it
+func (w *Wav) Trim(start, end time.Duration) error {
+	startFrame, endFrame, err := w.frameRange(start, end)
+	if err != nil {
+		return err
+	}
+
+	// Copy the groups that are kept, so that the rest can be freed
+	w.Data = append([]SampleGroup{}, w.Data[startFrame:endFrame]...)
+	w.updateSizes()
+
+	return nil
+}
+
+// Slice returns a new wav file holding the sample groups from index
+// `startFrame` up to (but not including) `endFrame`. The new wav shares
+// no data with the original, so either can be changed independently.
+func (w *Wav) Slice(startFrame, endFrame int) (*Wav, error) {
+	if startFrame < 0 || endFrame < startFrame || endFrame > len(w.Data) {
+		return nil, fmt.Errorf("invalid slice %v to %v of %v sample groups", startFrame, endFrame, len(w.Data))
+	}
+
+	slice := *w
+	slice.Data = copySampleGroups(w.Data[startFrame:endFrame])
+	slice.updateSizes()
+
+	return &slice, nil
+}
+
+// Split cuts the wav file at each of the given times, which must be in
+// ascending order, and returns the pieces as new wav files. Splitting at
+// n times gives n + 1 pieces. The original wav is left unchanged.
+func (w *Wav) Split(at ...time.Duration) ([]*Wav, error) {
+	splitFrames := make([]int, 0, len(at) + 1)
+	previous := time.Duration(0)
+	for _, offset := range at {
+		if offset < previous {
+			return nil, errors.New("split times must be in ascending order")
+		}
+		previous = offset
+
+		_, frame, err := w.frameRange(0, offset)
+		if err != nil {
+			return nil, err
+		}
+		splitFrames = append(splitFrames, frame)
+	}
+	splitFrames = append(splitFrames, len(w.Data))
+
+	pieces := make([]*Wav, 0, len(splitFrames))
+	startFrame := 0
+	for _, endFrame := range splitFrames {
+		piece, err := w.Slice(startFrame, endFrame)
+		if err != nil {
+			return nil, err
+		}
+		pieces = append(pieces, piece)
+		startFrame = endFrame
+	}
+
+	return pieces, nil
+}
+
+// copySampleGroups returns a copy of `data` that doesn't share any
+// channel data with it
+func copySampleGroups(data []SampleGroup) []SampleGroup {
+	channels := 0
+	if len(data) > 0 {
+		channels = len(data[0].ChannelData)
+	}
+
+	// Allocate every group's channel data in one go rather than per group
+	backing := make([]any, 0, len(data) * channels)
+	copied := make([]SampleGroup, len(data))
+	for i, sampleGroup := range data {
+		start := len(backing)
+		backing = append(backing, sampleGroup.ChannelData...)
+		copied[i].ChannelData = backing[start:len(backing):len(backing)]
+	}
+
+	return copied
+}
+
+// frameAt converts a time offset into the index of the sample group
+// at that time
+func (w *Wav) frameAt(offset time.Duration) int {
+	return int(math.Round(offset.Seconds() * float64(w.SampleRate)))
+}
+
+// frameRange converts the time range from `start` to `end` into the
+// indices of the sample groups it covers, making sure that the range
+// lies within the wav
+func (w *Wav) frameRange(start, end time.Duration) (int, int, error) {
+	if start < 0 || end < start {
+		return 0, 0, fmt.Errorf("invalid time range %v to %v", start, end)
+	}
+
+	startFrame, endFrame := w.frameAt(start), w.frameAt(end)
+	if endFrame > len(w.Data) {
+		duration := time.Duration(w.GetDuration() * float64(time.Second))
+		return 0, 0, fmt.Errorf("time range %v to %v goes past the end of the audio (%v)", start, end, duration)
+	}
+
+	return startFrame, endFrame, nil
 }
 
 // Concat takes another Wav struct and stitches the two audio files
 // together. The returned wav struct will have the number of channels
 // equal to the largest number of channels out of the two wavs being
-// concatenated.
+// concatenated. If the formats differ, the result uses the larger bit
+// depth, and is IEEE float if either wav is.
 func (w *Wav) Concat(toAdd *Wav) error {
-	revertAddedWav := false
-
-	if w.Channels == 2 || toAdd.Channels == 2 {
-		if w.Channels == 1 {
-			err := w.ConvertToStereo()
-			if err != nil {
-				return err
-			}
-		} else if toAdd.Channels == 1 {
-			err := toAdd.ConvertToStereo()
-			if err != nil {
-				return err
-			}
-
-			// So as to not cause any side effects to the added wav,
-			// set this flag to remember that the `toAdd` wav should
-			// be converted back to mono.
-			// Important to note that going from mono to stereo, then back
-			// to mono results in no data loss.
-			revertAddedWav = true
+	if err := w.matchChannelsAndRate(toAdd); err != nil {
+		return err
+	}
+
+	if w.isFloat() == toAdd.isFloat() && w.BitsPerSample == toAdd.BitsPerSample {
+		return w.concatSamples(toAdd)
+	}
+
+	// The formats differ, so go through normalized float samples to make sure
+	// both halves end up at the same level
+	samples, addedSamples, err := w.float64SamplesWith(toAdd)
+	if err != nil {
+		return err
+	}
+
+	combined, err := samples.Concat(addedSamples)
+	if err != nil {
+		return err
+	}
+	w.setCombinedFormat(toAdd)
+
+	return w.SetFromFloat64(combined)
+}
+
+// ConcatWithCrossfade stitches `toAdd` onto the end of the wav file like
+// Concat, but overlaps the two by `overlap`, fading the end of the wav
+// out while the start of `toAdd` fades in. The fades follow the given
+// curve, EqualPowerCurve being the usual choice for unrelated audio and
+// LinearCurve for audio that's in phase (e.g. two takes of the same
+// recording).
+func (w *Wav) ConcatWithCrossfade(toAdd *Wav, overlap time.Duration, curve Curve) error {
+	if !curve.valid() {
+		return errors.New("unknown fade curve")
+	}
+	if overlap < 0 {
+		return errors.New("overlap can't be negative")
+	}
+	if overlap.Seconds() > w.GetDuration() || overlap.Seconds() > toAdd.GetDuration() {
+		return fmt.Errorf("overlap of %v is longer than the audio being crossfaded", overlap)
+	}
+
+	if err := w.matchChannelsAndRate(toAdd); err != nil {
+		return err
+	}
+
+	samples, addedSamples, err := w.float64SamplesWith(toAdd)
+	if err != nil {
+		return err
+	}
+
+	// The overlap fits within both wavs, but resampling can round their
+	// lengths down a frame
+	overlapFrames := util.MinInt(w.frameAt(overlap), util.MinInt(samples.Frames(), addedSamples.Frames()))
+
+	start := samples.Frames() - overlapFrames
+	combined := NewBuffer[float64](samples.Channels(), start + addedSamples.Frames())
+	for c := range combined {
+		copy(combined[c], samples[c][:start])
+		copy(combined[c][start:], addedSamples[c])
+
+		for i := 0; i < overlapFrames; i++ {
+			x := (float64(i) + 0.5) / float64(overlapFrames)
+			combined[c][start + i] = samples[c][start + i] * curve.gain(1 - x) + addedSamples[c][i] * curve.gain(x)
 		}
 	}
+	w.setCombinedFormat(toAdd)
+
+	return w.SetFromFloat64(combined)
+}
+
+// matchChannelsAndRate converts the wav so that `toAdd` can be appended to
+// it. Mono audio is converted to stereo when `toAdd` is stereo, and the
+// wav is resampled to the sample rate of `toAdd`.
+func (w *Wav) matchChannelsAndRate(toAdd *Wav) error {
+	if toAdd.SampleRate == 0 {
+		return errors.New("sample rate must be greater than 0")
+	}
+
+	// Mono audio can be mixed with stereo audio, any other combination of
+	// differing channels can't be reconciled
+	if w.Channels == 1 && toAdd.Channels == 2 {
+		err := w.ConvertToStereo()
+		if err != nil {
+			return err
+		}
+	} else if w.Channels != toAdd.Channels && !(w.Channels == 2 && toAdd.Channels == 1) {
+		return fmt.Errorf("cannot concatenate wavs with %v and %v channels", w.Channels, toAdd.Channels)
+	}
 
 	if w.SampleRate != toAdd.SampleRate {
 		// Resample the current audio file so as to not introduce side effects
@@ -60,38 +301,79 @@ func (w *Wav) Concat(toAdd *Wav) error {
 		}
 	}
 
-	w.Data = append(w.Data, toAdd.Data...)
-	maxBitDepth := uint16(math.Max(float64(w.BitsPerSample), float64(toAdd.BitsPerSample)))
+	return nil
+}
 
-	// If there are differing bit depths we should normalize them
-	if w.BitsPerSample != toAdd.BitsPerSample {
-		for _, sampleGroup := range(w.Data) {
-			for j := 0; j < int(w.Channels); j++ {
-				intVal, err := CastToInt(sampleGroup.ChannelData[j])
-				if err != nil {
-					return err
-				}
-				if maxBitDepth == uint16(16) {
-					sampleGroup.ChannelData[j] = int16(intVal)
-				}
-				if maxBitDepth == uint16(32) {
-					sampleGroup.ChannelData[j] = int32(intVal)
-				}
-				if maxBitDepth == uint16(64) {
-					sampleGroup.ChannelData[j] = int64(intVal)
-				}
-			}
+// float64SamplesWith returns the normalized samples of both the wav and
+// `toAdd`, with mono samples of `toAdd` duplicated to stereo if the wav
+// is stereo
+func (w *Wav) float64SamplesWith(toAdd *Wav) (Buffer[float64], Buffer[float64], error) {
+	samples, err := w.Float64Samples()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// `toAdd` is only ever read from, so that it isn't affected by the
+	// concatenation
+	addedSamples, err := toAdd.Float64Samples()
+	if err != nil {
+		return nil, nil, err
+	}
+	if addedSamples.Channels() == 1 && samples.Channels() == 2 {
+		addedSamples = addedSamples.DuplicateToStereo()
+	}
+
+	return samples, addedSamples, nil
+}
+
+// setCombinedFormat switches the wav to a format that can hold the
+// samples of both itself and `toAdd`: the larger of the two bit depths,
+// and IEEE float if either is float
+func (w *Wav) setCombinedFormat(toAdd *Wav) {
+	if w.isFloat() == toAdd.isFloat() && w.BitsPerSample == toAdd.BitsPerSample {
+		return
+	}
+
+	formatType := PCMFormat
+	maxBitDepth := uint16(math.Max(float64(w.BitsPerSample), float64(toAdd.BitsPerSample)))
+	if w.isFloat() || toAdd.isFloat() {
+		// Float samples can only be 32 or 64 bits
+		formatType = IEEEFloatFormat
+		maxBitDepth = 32
+		if w.BitsPerSample > 32 || toAdd.BitsPerSample > 32 {
+			maxBitDepth = 64
 		}
 	}
+	w.setSampleFormat(formatType, maxBitDepth)
+}
 
-	w.DataSize = uint32(len(w.Data) + len(toAdd.Data) * int(w.Channels) * (int(maxBitDepth) / 8))
+// concatSamples appends the samples of `toAdd`, which must have the same
+// format as `w`
+func (w *Wav) concatSamples(toAdd *Wav) error {
+	channels := int(w.Channels)
+	for i, sampleGroup := range toAdd.Data {
+		if len(sampleGroup.ChannelData) != int(toAdd.Channels) {
+			return fmt.Errorf("sample group %v has %v channels, expected %v", i, len(sampleGroup.ChannelData), toAdd.Channels)
+		}
+	}
 
-	if revertAddedWav {
-		err := toAdd.ConvertToMono()
-		if err != nil {
-			return err
+	// Give the appended sample groups their own channel data, so that later
+	// changes to the wav don't show up in `toAdd`. A mono `toAdd` is
+	// duplicated into both channels of a stereo wav.
+	backing := make([]any, len(toAdd.Data) * channels)
+	if cap(w.Data) < len(w.Data) + len(toAdd.Data) {
+		grown := make([]SampleGroup, len(w.Data), len(w.Data) + len(toAdd.Data))
+		copy(grown, w.Data)
+		w.Data = grown
+	}
+	for i, sampleGroup := range toAdd.Data {
+		channelData := backing[i * channels : (i + 1) * channels : (i + 1) * channels]
+		for c := range channelData {
+			channelData[c] = sampleGroup.ChannelData[c % len(sampleGroup.ChannelData)]
 		}
+		w.Data = append(w.Data, SampleGroup{ChannelData: channelData})
 	}
+	w.updateSizes()
 
 	return nil
-}
\ No newline at end of file
+}
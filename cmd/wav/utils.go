@@ -20,55 +20,18 @@ func (w *Wav) GenerateBucketedAvgSampleVals(buckets, channel int, abs bool) ([]f
 		return []float64{}, fmt.Errorf("only %v channels available, but looking for channel number %v", w.Channels, channel + 1)
 	}
 
+	buffer, err := w.samples()
+	if err != nil {
+		return []float64{}, err
+	}
+	channelData := buffer.channelFloat64(channel)
+
 	for i := 0; i < buckets; i++ {
 		for j := 0; j < samplesInBuckets; j++ {
-			if w.BitsPerSample == uint16(8) {
-				intVal, ok := w.Data[i * samplesInBuckets + j].ChannelData[channel].(uint8)
-				if !ok {
-					return []float64{}, fmt.Errorf("could not convert %v to int", w.Data[i * samplesInBuckets + j].ChannelData[channel])
-				}
-
-				if abs {
-					bucketVals[i] += math.Abs(float64(intVal))
-				} else {
-					bucketVals[i] += float64(intVal)
-				}
-			}
-			if w.BitsPerSample == uint16(16) {
-				intVal, ok := w.Data[i * samplesInBuckets + j].ChannelData[channel].(int16)
-				if !ok {
-					return []float64{}, fmt.Errorf("could not convert %v to int", w.Data[i * samplesInBuckets + j].ChannelData[channel])
-				}
-
-				if abs {
-					bucketVals[i] += math.Abs(float64(intVal))
-				} else {
-					bucketVals[i] += float64(intVal)
-				}
-			}
-			if w.BitsPerSample == uint16(32) {
-				intVal, ok := w.Data[i * samplesInBuckets + j].ChannelData[channel].(int32)
-				if !ok {
-					return []float64{}, fmt.Errorf("could not convert %v to int", w.Data[i * samplesInBuckets + j].ChannelData[channel])
-				}
-				
-				if abs {
-					bucketVals[i] += math.Abs(float64(intVal))
-				} else {
-					bucketVals[i] += float64(intVal)
-				}
-			}
-			if w.BitsPerSample == uint16(64) {
-				intVal, ok := w.Data[i * samplesInBuckets + j].ChannelData[channel].(int64)
-				if !ok {
-					return []float64{}, fmt.Errorf("could not convert %v to int", w.Data[i * samplesInBuckets + j].ChannelData[channel])
-				}
-
-				if abs {
-					bucketVals[i] += math.Abs(float64(intVal))
-				} else {
-					bucketVals[i] += float64(intVal)
-				}
+			if abs {
+				bucketVals[i] += math.Abs(channelData[i * samplesInBuckets + j])
+			} else {
+				bucketVals[i] += channelData[i * samplesInBuckets + j]
 			}
 		}
 
@@ -103,7 +66,8 @@ func (w *Wav) GenerateSplinePoints(height, width float64, buckets, channel int)
 }
 
 // CastToInt will a variable input value which could be uint8, int16, int32
-// or int64 and normalize it to be an int
+// (used for both 24 and 32-bit audio) or int64 and normalize it to be an int.
+// float32 and float64 values are rounded to the nearest int.
 func CastToInt(v any) (int, error) {
 	uint8Val, ok := v.(uint8)
 	if ok {
@@ -121,11 +85,41 @@ func CastToInt(v any) (int, error) {
 	if ok {
 		return int(int64Val), nil
 	}
+	float32Val, ok := v.(float32)
+	if ok {
+		return int(math.Round(float64(float32Val))), nil
+	}
+	float64Val, ok := v.(float64)
+	if ok {
+		return int(math.Round(float64Val)), nil
+	}
 
 	return 0, errors.New("cannot convert value to int")
 		
 }
 
+// CastToFloat64 will take a variable input value which could be any of the
+// sample types (uint8, int16, int32, int64, float32 or float64) and return
+// it as a float64, without any rescaling
+func CastToFloat64(v any) (float64, error) {
+	switch val := v.(type) {
+	case uint8:
+		return float64(val), nil
+	case int16:
+		return float64(val), nil
+	case int32:
+		return float64(val), nil
+	case int64:
+		return float64(val), nil
+	case float32:
+		return float64(val), nil
+	case float64:
+		return val, nil
+	}
+
+	return 0, errors.New("cannot convert value to float64")
+}
+
 // Const vals representing GenerateSvg config
 const pathTemplate = "<rect x=\"%d\" y=\"%d\" width=\"%d\" height=\"%d\" fill=\"%s\" ry=\"%d\" rx=\"%d\"/>"
 const svgHeight = 100
@@ -11,9 +11,53 @@ import (
 
 const (
 	fmtSize = 16
+	extensibleFmtSize = 40
+	extensionSize = 22
 	chunkHeadingSize = 8
+
+	// decodeBlockSize is the number of sample groups Decode reads at a time
+	decodeBlockSize = 4096
+
+	// maxDecodePreallocation is the most sample groups Decode allocates up
+	// front, before it has read the audio data they're for
+	maxDecodePreallocation = 1 << 20
+)
+
+// Values of the FormatType field that this package knows how to handle
+const (
+	// PCMFormat marks integer PCM audio data
+	PCMFormat uint16 = 1
+
+	// IEEEFloatFormat marks 32 or 64-bit IEEE 754 floating point audio data
+	IEEEFloatFormat uint16 = 3
+
+	// ExtensibleFormat marks a WAVE_FORMAT_EXTENSIBLE fmt chunk, where the
+	// actual format of the audio data is given by the SubFormat GUID
+	ExtensibleFormat uint16 = 0xFFFE
+)
+
+// Sub-format GUIDs used by WAVE_FORMAT_EXTENSIBLE fmt chunks, in the byte order
+// they're stored in the file
+var (
+	// PCMSubFormat is the KSDATAFORMAT_SUBTYPE_PCM GUID
+	PCMSubFormat = subFormatGUID(PCMFormat)
+
+	// IEEEFloatSubFormat is the KSDATAFORMAT_SUBTYPE_IEEE_FLOAT GUID
+	IEEEFloatSubFormat = subFormatGUID(IEEEFloatFormat)
 )
 
+// subFormatGUID builds the sub-format GUID for the given format type. Every
+// KSDATAFORMAT_SUBTYPE GUID shares the same 14 trailing bytes, with the first
+// two bytes holding the format type
+func subFormatGUID(formatType uint16) [16]byte {
+	guid := [16]byte{
+		0, 0, 0x00, 0x00, 0x00, 0x00, 0x10, 0x00,
+		0x80, 0x00, 0x00, 0xaa, 0x00, 0x38, 0x9b, 0x71,
+	}
+	copy(guid[:2], util.UInt16ToBytes(formatType))
+	return guid
+}
+
 // SampleGroup is a representation of the group of samples that represent one
 // moment in time, with each sample in the group representing a channel.
 type SampleGroup struct {
@@ -22,9 +66,43 @@ type SampleGroup struct {
 	ChannelData []any
 }
 
+// Format is a struct representation of the fmt chunk of a .wav audio file,
+// describing how its sample data is laid out
+type Format struct {
+	// FormatType is the type of audio format (1 = PCM, 3 = IEEE float)
+	FormatType uint16
+
+	// Channels is the number of channels
+	Channels uint16
+
+	// SampleRate is the number of samples per second
+	SampleRate uint32
+
+	// DataRate is the average number of bytes per second
+	DataRate uint32
+
+	// DataBlockSize is the minimum atomic unit of data, in bytes
+	DataBlockSize uint16
+
+	// BitsPerSample is the number of bits per sample (bit depth)
+	BitsPerSample uint16
+
+	// ValidBitsPerSample is the number of bits of precision actually used in
+	// each sample. 0 means all bits are valid
+	ValidBitsPerSample uint16
+
+	// ChannelMask maps the channels to speaker positions. 0 means no
+	// particular speaker assignment
+	ChannelMask uint32
+
+	// SubFormat is the GUID identifying the format of the audio data when
+	// FormatType is ExtensibleFormat
+	SubFormat [16]byte
+}
+
 // Wav is a struct representation of a .wav audio file
 type Wav struct {
-	// FormatType is the type of audio format (1 = PCM)
+	// FormatType is the type of audio format (1 = PCM, 3 = IEEE float)
 	FormatType uint16
 
 	// Channels is the number of channels
@@ -44,6 +122,19 @@ type Wav struct {
 	// BitsPerSample is the number of bits per sample (bit depth)
 	BitsPerSample uint16
 
+	// ValidBitsPerSample is the number of bits of precision actually used in
+	// each sample, taken from extensible fmt chunks (e.g. 20 for 20-bit audio
+	// stored in 24-bit containers). 0 means all bits are valid
+	ValidBitsPerSample uint16
+
+	// ChannelMask maps the channels to speaker positions, taken from
+	// extensible fmt chunks. 0 means no particular speaker assignment
+	ChannelMask uint32
+
+	// SubFormat is the GUID identifying the format of the audio data when
+	// FormatType is ExtensibleFormat (see PCMSubFormat and IEEEFloatSubFormat)
+	SubFormat [16]byte
+
 	// DataSize is the size in bytes of the audio data
 	DataSize uint32
 	
@@ -54,68 +145,26 @@ type Wav struct {
 // Encode will take the attributes found in the parent struct and will output
 // a byte representation of a valid wav file.
 func (w *Wav) Encode() ([]byte, error) {
-	encodedWav := []byte("RIFF")
-
-	fileSize := 3 * chunkHeadingSize + fmtSize + w.DataSize + 4
-	encodedWav = append(encodedWav, util.UInt32ToBytes(uint32(fileSize))...)
+	format := w.Format()
+	encodedWav := appendHeader([]byte{}, format, w.DataSize)
 
-	encodedWav = append(encodedWav, "WAVE"...)
-
-	// fmt chunk
-	encodedWav = append(encodedWav, "fmt "...)
-
-	// fmt chunk should always be 16 bytes long
-	encodedWav = append(encodedWav, util.UInt32ToBytes(uint32(16))...)
-	encodedWav = append(encodedWav, util.UInt16ToBytes(w.FormatType)...)
-	encodedWav = append(encodedWav, util.UInt16ToBytes(w.Channels)...)
-	encodedWav = append(encodedWav, util.UInt32ToBytes(w.SampleRate)...)
-	encodedWav = append(encodedWav, util.UInt32ToBytes(w.DataRate)...)
-	encodedWav = append(encodedWav, util.UInt16ToBytes(w.DataBlockSize)...)
-	encodedWav = append(encodedWav, util.UInt16ToBytes(w.BitsPerSample)...)
+	encodedWav, err := appendSampleGroups(encodedWav, w.Data, format)
+	if err != nil {
+		return nil, err
+	}
 
-	encodedWav = append(encodedWav, "data"...)
-	encodedWav = append(encodedWav, util.UInt32ToBytes(w.DataSize)...)
-	
-	// Write data
-	for _, sampleGroup := range(w.Data) {
-		for _, sample := range(sampleGroup.ChannelData) {
-			if w.BitsPerSample == uint16(8) {
-				eightBitSample, ok := sample.(uint8)
-				if !ok {
-					return nil, fmt.Errorf("can't cast data point %v to byte", sample)
-				}
-				encodedWav = append(encodedWav, byte(eightBitSample))
-			} else if w.BitsPerSample == uint16(16) {
-				sixteenBitSample, ok := sample.(int16)
-				if !ok {
-					return nil, fmt.Errorf("can't cast data point %v to int16", sample)
-				}
-				encodedWav = append(encodedWav, util.UInt16ToBytes(uint16(sixteenBitSample))...)
-			} else if w.BitsPerSample == uint16(32) {
-				thirtyTwoBitSample, ok := sample.(int32)
-				if !ok {
-					return nil, fmt.Errorf("can't cast data point %v to int32", sample)
-				}
-				encodedWav = append(encodedWav, util.UInt32ToBytes(uint32(thirtyTwoBitSample))...)
-			} else if w.BitsPerSample == uint16(64) {
-				sixtyFourBitSample, ok := sample.(int64)
-				if !ok {
-					return nil, fmt.Errorf("can't cast data point %v to int64", sample)
-				}
-				encodedWav = append(encodedWav, util.UInt64ToBytes(uint64(sixtyFourBitSample))...)
-			}
-		}
+	// Chunks must be word aligned, so odd sized data chunks (possible with 8
+	// and 24 bit audio) are followed by a single pad byte
+	if w.DataSize % 2 == 1 {
+		encodedWav = append(encodedWav, 0)
 	}
 
 	return encodedWav, nil
 }
 
+// Write encodes the wav and saves it to the file at `filename`, streaming the
+// sample data to the file rather than building the whole file in memory.
 func (w *Wav) Write(filename string) error {
-	bytes, err := w.Encode()
-	if err != nil {
-        return err
-    }
-
 	output, err := os.Create(filename)
     if err != nil {
         return err
@@ -126,77 +175,54 @@ func (w *Wav) Write(filename string) error {
 		}
 	}()
 
-	if _, err := output.Write(bytes); err != nil {
+	encoder, err := NewEncoder(output, w.Format())
+	if err != nil {
 		return err
 	}
 
-	return nil
+	if err := encoder.Write(w.Data); err != nil {
+		return err
+	}
+
+	return encoder.Close()
 }
 
 // Decode will take an input wav file and return a `Wav` struct with fields representing
 // each attribute of the file.
 func Decode(input io.Reader) (*Wav, error) {
-	decodedWav := &Wav{}
-	riff, err := util.ReadBytes(input, 4)
+	decoder, err := NewDecoder(input)
 	if err != nil {
 		return nil, err
 	}
-	if string(riff) != "RIFF" {
-		return nil, errors.New("corrupted file, first 4 bytes not 'RIFF'")
-	}
 
-	_, err = util.ReadBytes(input, 4)
-	if err != nil {
-		return nil, err
-	}
+	decodedWav := &Wav{}
+	decodedWav.setFormat(decoder.Format())
+	decodedWav.DataSize = decoder.DataSize()
 
-	wave, err := util.ReadBytes(input, 4)
-	if err != nil {
-		return nil, err
-	}
-	if string(wave) != "WAVE" {
-		return nil, errors.New("corrupted file, bytes 9-12 do not read 'WAVE'")
-	}
+	// The header's length is only used as a hint, since a corrupt or truncated
+	// file can claim far more audio than it holds
+	frames := decoder.Frames()
+	decodedWav.Data = make([]SampleGroup, 0, util.MinInt(util.MaxInt(frames, 0), maxDecodePreallocation))
 
-	// Scan through the chunks of the file, we only care about the fmt and data
-	// chunks
+	// Decode in blocks so that the decoder's raw byte buffer stays small, until
+	// the audio data (or, when its length isn't known, the input) runs out
 	for {
-		chunkHeader, err := util.ReadBytes(input, 4)
-		if err != nil {
-			return nil, err
-		}
+		position := len(decodedWav.Data)
+		decodedWav.Data = append(decodedWav.Data, make([]SampleGroup, decodeBlockSize)...)
 
-		chunkSizeBytes, err := util.ReadBytes(input, 4)
+		framesRead, err := decoder.Read(decodedWav.Data[position:])
+		decodedWav.Data = decodedWav.Data[:position + framesRead]
+		if err == io.EOF {
+			break
+		}
 		if err != nil {
 			return nil, err
 		}
-
-		chunkSize := util.BytesToUInt32(chunkSizeBytes)
-
-		if string(chunkHeader) == "fmt " {
-			err = readFmtChunk(input, decodedWav)
-			if err != nil {
-				return nil, err
-			}
-		} else if string(chunkHeader) == "data" {
-			decodedWav.DataSize = chunkSize
-			err = readDataChunk(input, decodedWav, chunkSize)
-			if err != nil {
-				return nil, err
-			}
-		} else {
-			// Skip to the next chunk
-			_, err = util.ReadBytes(input, int(chunkSize))
-			if err != nil {
-				return nil, err
-			}
-		}
-
-		if decodedWav.Channels != 0 && len(decodedWav.Data) > 0 {
-			break
-		}
 	}
-	
+	if frames < 0 {
+		decodedWav.DataSize = uint32(len(decodedWav.Data)) * uint32(decodedWav.DataBlockSize)
+	}
+
 	return decodedWav, nil
 }
 
@@ -206,68 +232,178 @@ func (w *Wav) GetDuration() float64 {
 	return float64(w.DataSize) / bytesPerSample / float64(w.SampleRate) / float64(w.Channels)
 }
 
-func readFmtChunk(input io.Reader, wav *Wav) error {
+// Format returns the fields of the wav that make up its fmt chunk
+func (w *Wav) Format() Format {
+	return Format{
+		FormatType: w.FormatType,
+		Channels: w.Channels,
+		SampleRate: w.SampleRate,
+		DataRate: w.DataRate,
+		DataBlockSize: w.DataBlockSize,
+		BitsPerSample: w.BitsPerSample,
+		ValidBitsPerSample: w.ValidBitsPerSample,
+		ChannelMask: w.ChannelMask,
+		SubFormat: w.SubFormat,
+	}
+}
+
+// setFormat copies the fields of a fmt chunk into the wav
+func (w *Wav) setFormat(format Format) {
+	w.FormatType = format.FormatType
+	w.Channels = format.Channels
+	w.SampleRate = format.SampleRate
+	w.DataRate = format.DataRate
+	w.DataBlockSize = format.DataBlockSize
+	w.BitsPerSample = format.BitsPerSample
+	w.ValidBitsPerSample = format.ValidBitsPerSample
+	w.ChannelMask = format.ChannelMask
+	w.SubFormat = format.SubFormat
+}
+
+// sampleFormat returns the format of the audio data, looking through the
+// SubFormat GUID of extensible wavs
+func (f Format) sampleFormat() uint16 {
+	if f.FormatType == ExtensibleFormat {
+		return util.BytesToUInt16(f.SubFormat[:2])
+	}
+
+	return f.FormatType
+}
+
+// isFloat reports whether the samples are IEEE floats rather than integers
+func (f Format) isFloat() bool {
+	return f.sampleFormat() == IEEEFloatFormat
+}
+
+// needsExtensibleFmt reports whether the format can only be described by a
+// WAVE_FORMAT_EXTENSIBLE fmt chunk: either it was decoded from one, it has
+// more than 2 channels, it uses fewer bits than its container, or it has a
+// speaker assignment
+func (f Format) needsExtensibleFmt() bool {
+	return f.FormatType == ExtensibleFormat ||
+		f.Channels > 2 ||
+		(f.ValidBitsPerSample != 0 && f.ValidBitsPerSample != f.BitsPerSample) ||
+		f.ChannelMask != 0
+}
+
+// isFloat reports whether the samples of the wav are IEEE floats rather than
+// integers
+func (w *Wav) isFloat() bool {
+	return w.Format().isFloat()
+}
+
+func readFmtChunk(input io.Reader, format *Format, chunkSize uint32) error {
+	if chunkSize < fmtSize {
+		return fmt.Errorf("corrupted file, fmt chunk is only %v bytes long", chunkSize)
+	}
+
 	formatType, err := util.ReadBytes(input, 2)
 	if err != nil {
 		return err
 	}
-	wav.FormatType = util.BytesToUInt16(formatType)
+	format.FormatType = util.BytesToUInt16(formatType)
 
 	numChannels, err := util.ReadBytes(input, 2)
 	if err != nil {
 		return err
 	}
-	wav.Channels = util.BytesToUInt16(numChannels)
+	format.Channels = util.BytesToUInt16(numChannels)
 
 	sampleRate, err := util.ReadBytes(input, 4)
 	if err != nil {
 		return err
 	}
-	wav.SampleRate = util.BytesToUInt32(sampleRate)
+	format.SampleRate = util.BytesToUInt32(sampleRate)
 
 	dataRate, err := util.ReadBytes(input, 4)
 	if err != nil {
 		return err
 	}
-	wav.DataRate = util.BytesToUInt32(dataRate)
+	format.DataRate = util.BytesToUInt32(dataRate)
 
 	dataBlockSize, err := util.ReadBytes(input, 2)
 	if err != nil {
 		return err
 	}
-	wav.DataBlockSize = util.BytesToUInt16(dataBlockSize)
+	format.DataBlockSize = util.BytesToUInt16(dataBlockSize)
 
 	bitsPerSample, err := util.ReadBytes(input, 2)
 	if err != nil {
 		return err
 	}
-	wav.BitsPerSample = util.BytesToUInt16(bitsPerSample)
+	format.BitsPerSample = util.BytesToUInt16(bitsPerSample)
 
-	if wav.BitsPerSample != 16 {
-		return fmt.Errorf("only 16-bit wav files are currently supported (current bits/sample = %v)", wav.BitsPerSample)
-	}
+	bytesRead := uint32(fmtSize)
+	if chunkSize >= fmtSize + 2 {
+		extraSize, err := util.ReadBytes(input, 2)
+		if err != nil {
+			return err
+		}
+		bytesRead += 2
 
-	return nil
-}
+		if format.FormatType == ExtensibleFormat {
+			if util.BytesToUInt16(extraSize) < extensionSize || chunkSize < extensibleFmtSize {
+				return errors.New("corrupted file, extensible fmt chunk is too short")
+			}
+
+			validBitsPerSample, err := util.ReadBytes(input, 2)
+			if err != nil {
+				return err
+			}
+			format.ValidBitsPerSample = util.BytesToUInt16(validBitsPerSample)
 
-func readDataChunk(input io.Reader, wav *Wav, chunkSize uint32) error {
-	dataPoints := []SampleGroup{}
-	dataSize := int(wav.DataSize)
-	bytesPerSampleGroup := int(int(wav.BitsPerSample) / 8) * int(wav.Channels)
-	for position := 0; position < dataSize; position += bytesPerSampleGroup {
-		newDataPoint := SampleGroup{}
-		for i := 0; i < int(wav.Channels); i++ {
-			sample, err := util.ReadSample(input, wav.BitsPerSample)
+			channelMask, err := util.ReadBytes(input, 4)
 			if err != nil {
 				return err
 			}
+			format.ChannelMask = util.BytesToUInt32(channelMask)
 
-			newDataPoint.ChannelData = append(newDataPoint.ChannelData, sample)
+			subFormat, err := util.ReadBytes(input, 16)
+			if err != nil {
+				return err
+			}
+			copy(format.SubFormat[:], subFormat)
+			bytesRead += extensionSize
+
+			if format.SubFormat != subFormatGUID(format.sampleFormat()) {
+				return fmt.Errorf("unsupported sub-format %x", format.SubFormat)
+			}
+			if format.ValidBitsPerSample > format.BitsPerSample {
+				return fmt.Errorf("valid bits/sample (%v) exceeds bits/sample (%v)", format.ValidBitsPerSample, format.BitsPerSample)
+			}
 		}
+	} else if format.FormatType == ExtensibleFormat {
+		return errors.New("corrupted file, extensible fmt chunk is too short")
+	}
 
-		dataPoints = append(dataPoints, newDataPoint)
+	// Skip anything left in the chunk, including the pad byte that follows
+	// odd sized chunks
+	if remaining := chunkSize + chunkSize % 2 - bytesRead; remaining > 0 {
+		if _, err := util.ReadBytes(input, int(remaining)); err != nil {
+			return err
+		}
+	}
+
+	return format.validate()
+}
+
+// validate checks that the format describes audio data that this package can
+// read and write
+func (f Format) validate() error {
+	switch f.sampleFormat() {
+	case PCMFormat:
+		switch f.BitsPerSample {
+		case 8, 16, 24, 32, 64:
+		default:
+			return fmt.Errorf("only 8, 16, 24, 32 and 64-bit PCM wav files are currently supported (current bits/sample = %v)", f.BitsPerSample)
+		}
+	case IEEEFloatFormat:
+		if f.BitsPerSample != 32 && f.BitsPerSample != 64 {
+			return fmt.Errorf("only 32 and 64-bit float wav files are currently supported (current bits/sample = %v)", f.BitsPerSample)
+		}
+	default:
+		return fmt.Errorf("unsupported format type %v", f.sampleFormat())
 	}
 
-	wav.Data = dataPoints
 	return nil
-}
\ No newline at end of file
+}
@@ -0,0 +1,32 @@
+package wav
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"testing"
+)
+
+// TestDecodeOversizedDataChunk checks that a file whose header claims far more
+// audio than it holds fails to decode, rather than allocating room for all of
+// the claimed audio
+func TestDecodeOversizedDataChunk(t *testing.T) {
+	const claimedSize = 0x7FFFFFF0
+
+	var input bytes.Buffer
+	input.WriteString("RIFF")
+	binary.Write(&input, binary.LittleEndian, uint32(claimedSize + 36))
+	input.WriteString("WAVEfmt ")
+	binary.Write(&input, binary.LittleEndian, []uint32{16})
+	binary.Write(&input, binary.LittleEndian, []uint16{PCMFormat, 2})
+	binary.Write(&input, binary.LittleEndian, []uint32{44100, 44100 * 4})
+	binary.Write(&input, binary.LittleEndian, []uint16{4, 16})
+	input.WriteString("data")
+	binary.Write(&input, binary.LittleEndian, uint32(claimedSize))
+	input.Write(make([]byte, 10))
+
+	_, err := Decode(&input)
+	if err != io.ErrUnexpectedEOF {
+		t.Errorf("Decode() error = %v, want %v", err, io.ErrUnexpectedEOF)
+	}
+}
@@ -25,9 +25,9 @@ func main() {
 		panic(fmt.Sprintf("decoding wav file: %v", err.Error()))
 	}
 
-	newWav.SlowDown(2)
+	err = newWav.SlowDown(2)
 	if err != nil {
-		panic(fmt.Sprintf("speeding up wav file: %v", err.Error()))
+		panic(fmt.Sprintf("slowing down wav file: %v", err.Error()))
 	}
 
 	err = newWav.Write(fmt.Sprintf("%s/output.wav", currentDirectory))
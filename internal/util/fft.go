@@ -0,0 +1,70 @@
+package util
+
+import (
+	"math"
+	"math/bits"
+	"math/cmplx"
+)
+
+// NextPowerOfTwo returns the smallest power of two that is >= n
+func NextPowerOfTwo(n int) int {
+	if n <= 1 {
+		return 1
+	}
+
+	return 1 << bits.Len(uint(n - 1))
+}
+
+// FFT performs an in place, radix-2 fast Fourier transform of `x`, whose
+// length must be a power of two
+func FFT(x []complex128) {
+	fft(x, false)
+}
+
+// IFFT performs an in place inverse fast Fourier transform of `x`, whose length
+// must be a power of two. The result is scaled by 1/len(x), so that IFFT undoes
+// FFT.
+func IFFT(x []complex128) {
+	fft(x, true)
+
+	scale := complex(1 / float64(len(x)), 0)
+	for i := range x {
+		x[i] *= scale
+	}
+}
+
+func fft(x []complex128, inverse bool) {
+	n := len(x)
+	if n <= 1 {
+		return
+	}
+
+	// Reorder the input into bit reversed order, so that the butterflies below
+	// can work in place
+	shift := bits.UintSize - bits.Len(uint(n - 1))
+	for i := 0; i < n; i++ {
+		j := int(bits.Reverse(uint(i)) >> shift)
+		if i < j {
+			x[i], x[j] = x[j], x[i]
+		}
+	}
+
+	sign := -1.0
+	if inverse {
+		sign = 1.0
+	}
+
+	for size := 2; size <= n; size <<= 1 {
+		step := cmplx.Rect(1, sign * 2 * math.Pi / float64(size))
+		for start := 0; start < n; start += size {
+			twiddle := complex(1, 0)
+			for k := 0; k < size / 2; k++ {
+				even := x[start + k]
+				odd := x[start + k + size / 2] * twiddle
+				x[start + k] = even + odd
+				x[start + k + size / 2] = even - odd
+				twiddle *= step
+			}
+		}
+	}
+}
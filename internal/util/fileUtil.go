@@ -4,19 +4,20 @@ import (
 	"encoding/binary"
 	"fmt"
 	"io"
+	"math"
 )
 
 // Read bytes is a helper function that will read `numBytes` from the `input`,
 // and return the value of those bytes.
 func ReadBytes(input io.Reader, numBytes int) ([]byte, error) {
 	output := make([]byte, numBytes)
-	bytesRead, err := input.Read(output)
+	bytesRead, err := io.ReadFull(input, output)
+	if err == io.ErrUnexpectedEOF {
+		return []byte{}, fmt.Errorf("expected %v bytes, read %v", numBytes, bytesRead)
+	}
 	if err != nil {
 		return []byte{}, err
 	}
-	if bytesRead != numBytes {
-		return []byte{}, fmt.Errorf("expected %v bytes, read %v", numBytes, bytesRead)
-	}
 
 	return output, nil
 }
@@ -29,6 +30,18 @@ func UInt64ToBytes(num uint64) []byte {
 	return byteRepresentation
 }
 
+// Float64ToBytes takes a float64 and returns the little endian encoded IEEE 754
+// byte sequence representation of it
+func Float64ToBytes(num float64) []byte {
+	return UInt64ToBytes(math.Float64bits(num))
+}
+
+// Float32ToBytes takes a float32 and returns the little endian encoded IEEE 754
+// byte sequence representation of it
+func Float32ToBytes(num float32) []byte {
+	return UInt32ToBytes(math.Float32bits(num))
+}
+
 // BytesToUInt32 will take a byte array and convert it to uint32 assuming little
 // endian encoding
 func BytesToUInt32(bytes []byte) uint32 {
@@ -49,6 +62,18 @@ func BytesToUInt16(bytes []byte) uint16 {
 	return binary.LittleEndian.Uint16(bytes)
 }
 
+// BytesToInt24 will take a 3 byte array and convert it to a sign extended int32
+// assuming little endian encoding
+func BytesToInt24(bytes []byte) int32 {
+	return int32(uint32(bytes[0])<<8|uint32(bytes[1])<<16|uint32(bytes[2])<<24) >> 8
+}
+
+// Int24ToBytes takes an int32 holding a 24 bit value and returns the packed,
+// 3 byte little endian encoded byte sequence representation of it
+func Int24ToBytes(num int32) []byte {
+	return []byte{byte(num), byte(num >> 8), byte(num >> 16)}
+}
+
 // UInt16ToBytes takes a uint16 and returns the little endian encoded byte sequence
 // representation of it
 func UInt16ToBytes(num uint16) []byte {
@@ -58,8 +83,8 @@ func UInt16ToBytes(num uint16) []byte {
 }
 
 // ReadSample reads in one sample of audio data
-// For now I will only support 8, 16, 32, and 64 bit depths
-// Can return either uint8, int16, int32, or int64
+// For now I will only support 8, 16, 24, 32, and 64 bit depths
+// Can return either uint8, int16, int32 (for 24 and 32 bit), or int64
 func ReadSample(input io.Reader, bitsPerSample uint16) (any, error) {
 	bytesPerSample := int(bitsPerSample) / 8
 
@@ -68,6 +93,12 @@ func ReadSample(input io.Reader, bitsPerSample uint16) (any, error) {
 		return 0, err
 	}
 
+	return BytesToSample(byteData, bitsPerSample)
+}
+
+// BytesToSample converts the little endian encoded bytes of one integer sample
+// into its value, using the same types as ReadSample
+func BytesToSample(byteData []byte, bitsPerSample uint16) (any, error) {
 	if bitsPerSample == uint16(8) {
 		// If 8 bits per sample, only one byte should have been read
 		return uint8(byteData[0]), nil
@@ -76,6 +107,9 @@ func ReadSample(input io.Reader, bitsPerSample uint16) (any, error) {
 		intRepr := binary.LittleEndian.Uint16(byteData)
 		return int16(intRepr), nil
 	}
+	if bitsPerSample == uint16(24) {
+		return BytesToInt24(byteData), nil
+	}
 	if bitsPerSample == uint16(32) {
 		intRepr := binary.LittleEndian.Uint32(byteData)
 		return int32(intRepr), nil
@@ -85,5 +119,34 @@ func ReadSample(input io.Reader, bitsPerSample uint16) (any, error) {
 		return int64(intRepr), nil
 	}
 
-	return 0, fmt.Errorf("bit depth not one of 8, 16, 32, or 64 (%d)", bitsPerSample)
-}
\ No newline at end of file
+	return 0, fmt.Errorf("bit depth not one of 8, 16, 24, 32, or 64 (%d)", bitsPerSample)
+}
+
+// ReadFloatSample reads in one IEEE 754 floating point sample of audio data.
+// Only 32 and 64 bit depths are valid for floating point audio.
+// Can return either float32 or float64
+func ReadFloatSample(input io.Reader, bitsPerSample uint16) (any, error) {
+	if bitsPerSample != uint16(32) && bitsPerSample != uint16(64) {
+		return 0, fmt.Errorf("float bit depth not one of 32 or 64 (%d)", bitsPerSample)
+	}
+
+	byteData, err := ReadBytes(input, int(bitsPerSample) / 8)
+	if err != nil {
+		return 0, err
+	}
+
+	return BytesToFloatSample(byteData, bitsPerSample)
+}
+
+// BytesToFloatSample converts the little endian encoded bytes of one IEEE 754
+// floating point sample into its value, using the same types as ReadFloatSample
+func BytesToFloatSample(byteData []byte, bitsPerSample uint16) (any, error) {
+	if bitsPerSample == uint16(32) {
+		return math.Float32frombits(binary.LittleEndian.Uint32(byteData)), nil
+	}
+	if bitsPerSample == uint16(64) {
+		return math.Float64frombits(binary.LittleEndian.Uint64(byteData)), nil
+	}
+
+	return 0, fmt.Errorf("float bit depth not one of 32 or 64 (%d)", bitsPerSample)
+}
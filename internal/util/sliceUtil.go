@@ -42,4 +42,35 @@ func MaxAbsValue(slice []float64) (float64, error) {
 	}
 
 	return maxVal, nil
-}
\ No newline at end of file
+}
+
+// Mean returns the average of an array of float64s, or 0 if it's empty
+func Mean(slice []float64) float64 {
+	if len(slice) == 0 {
+		return 0
+	}
+	sum := 0.0
+	for _, v := range slice {
+		sum += v
+	}
+
+	return sum / float64(len(slice))
+}
+
+// MinInt returns the smaller of two ints
+func MinInt(a, b int) int {
+	if a < b {
+		return a
+	}
+
+	return b
+}
+
+// MaxInt returns the larger of two ints
+func MaxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+
+	return b
+}